@@ -0,0 +1,330 @@
+// Package redis tool
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	v8 "github.com/go-redis/redis/v8"
+)
+
+// Codec 缓存值的序列化方式
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec json序列化，Cache 的默认 Codec
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// CacheOptions 缓存参数
+type CacheOptions struct {
+	// Prefix key前缀
+	Prefix string
+	// Codec 序列化方式，为空时使用 JSONCodec
+	Codec Codec
+	// LockTTL 跨实例加载锁的过期时间，同一个key只有获得锁的实例执行 loader，0 表示不使用分布式锁
+	LockTTL time.Duration
+	// LockWait 未获得锁时等待其他实例写入缓存的最长时间，超时后自行加载，为0时等于 LockTTL
+	LockWait time.Duration
+	// LoadTimeout 加载的超时时间，为0时为10秒
+	// 同一个key的并发加载合并后在独立的 ctx 中执行，不受单个调用者取消或超时的影响
+	LoadTimeout time.Duration
+	// NegativeTTL loader 返回 ErrNotFound 时写入空值标记的缓存时间，期间直接返回 ErrNotFound，0 表示不缓存
+	NegativeTTL time.Duration
+}
+
+// cacheNilMarker 空值标记，表示数据不存在
+const cacheNilMarker = "\x00redis-cache-nil\x00"
+
+// defaultCacheLoadTimeout 默认加载超时时间
+const defaultCacheLoadTimeout = 10 * time.Second
+
+// cacheLockPoll 未获得加载锁时检查缓存的间隔
+const cacheLockPoll = 50 * time.Millisecond
+
+// Cache 缓存旁路，值通过 Codec 序列化后存储在redis
+// 同一进程内相同key的并发加载合并为一次，设置 LockTTL 后跨实例也只加载一次
+type Cache[T any] struct {
+	r      *Redis
+	opts   CacheOptions
+	flight flightGroup[T]
+	// refreshing 正在后台刷新的key
+	refreshing sync.Map
+}
+
+// NewCache 创建缓存，opts 为nil时使用默认参数
+func NewCache[T any](r *Redis, opts *CacheOptions) *Cache[T] {
+	c := new(Cache[T])
+	c.r = r
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.Codec == nil {
+		c.opts.Codec = JSONCodec{}
+	}
+	if c.opts.LockWait <= 0 {
+		c.opts.LockWait = c.opts.LockTTL
+	}
+	if c.opts.LoadTimeout <= 0 {
+		c.opts.LoadTimeout = defaultCacheLoadTimeout
+	}
+	return c
+}
+
+func (c *Cache[T]) key(key string) string {
+	return c.opts.Prefix + key
+}
+
+func (c *Cache[T]) context(ctx context.Context) context.Context {
+	if ctx != nil {
+		return ctx
+	}
+	return c.r.ctx
+}
+
+// Get 读取缓存，key 不存在时返回 false，空值标记返回 ErrNotFound
+func (c *Cache[T]) Get(ctx context.Context, key string) (T, bool, error) {
+	var val T
+	data, err := c.r.cli.Get(c.context(ctx), c.key(key)).Bytes()
+	if err == v8.Nil {
+		return val, false, nil
+	}
+	if err != nil {
+		return val, false, err
+	}
+	if string(data) == cacheNilMarker {
+		return val, false, ErrNotFound
+	}
+
+	err = c.opts.Codec.Unmarshal(data, &val)
+	if err != nil {
+		return val, false, err
+	}
+	return val, true, nil
+}
+
+// Set 写入缓存，ttl 为0时不过期
+func (c *Cache[T]) Set(ctx context.Context, key string, val T, ttl time.Duration) error {
+	data, err := c.opts.Codec.Marshal(val)
+	if err != nil {
+		return err
+	}
+	return c.r.cli.Set(c.context(ctx), c.key(key), data, ttl).Err()
+}
+
+// SetNotFound 写入空值标记，ttl 内 Get 返回 ErrNotFound
+func (c *Cache[T]) SetNotFound(ctx context.Context, key string, ttl time.Duration) error {
+	return c.r.cli.Set(c.context(ctx), c.key(key), cacheNilMarker, ttl).Err()
+}
+
+// Delete 删除缓存
+func (c *Cache[T]) Delete(ctx context.Context, key ...string) error {
+	if len(key) <= 0 {
+		return nil
+	}
+
+	keys := make([]string, len(key))
+	for i, k := range key {
+		keys[i] = c.key(k)
+	}
+	return c.r.cli.Del(c.context(ctx), keys...).Err()
+}
+
+// GetOrLoad 读取缓存，不存在时调用 loader 加载并写入缓存，ttl 为缓存时间
+// redis 不可用时直接返回 loader 的结果，loader 返回错误时不写入缓存
+// loader 在独立的 ctx 中执行（超时时间为 LoadTimeout），ctx 结束时本次调用返回 ctx.Err()，加载继续进行
+// 设置了 NegativeTTL 时，loader 返回的 ErrNotFound 也被缓存，期间直接返回 ErrNotFound
+func (c *Cache[T]) GetOrLoad(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	ctx = c.context(ctx)
+	val, ok, err := c.Get(ctx, key)
+	if err == ErrNotFound {
+		return val, err
+	}
+	if err != nil {
+		log.Println(err)
+	}
+	if ok {
+		return val, nil
+	}
+
+	io := cacheIO[T]{
+		get: func(ctx context.Context) (T, bool, error) {
+			return c.Get(ctx, key)
+		},
+		set: func(ctx context.Context, val T, _ time.Duration) error {
+			return c.Set(ctx, key, val, ttl)
+		},
+		setNotFound: func(ctx context.Context) error {
+			return c.SetNotFound(ctx, key, c.opts.NegativeTTL)
+		},
+	}
+	return c.shareLoad(ctx, key, io, loader)
+}
+
+// shareLoad 合并同一个key的并发加载，加载在独立的 ctx 中执行，每个调用者只等待到自己的 ctx 结束
+func (c *Cache[T]) shareLoad(ctx context.Context, key string, io cacheIO[T], loader func(ctx context.Context) (T, error)) (T, error) {
+	return c.flight.do(ctx, key, func() (T, error) {
+		loadCtx, cancel := context.WithTimeout(c.r.ctx, c.opts.LoadTimeout)
+		defer cancel()
+		return c.load(loadCtx, key, io, loader)
+	})
+}
+
+// cacheIO 缓存的读写方式，GetOrLoad 与 GetOrRefresh 的存储格式不同
+type cacheIO[T any] struct {
+	// get 读取缓存，空值标记返回 ErrNotFound
+	get func(ctx context.Context) (T, bool, error)
+	// set 写入缓存，cost 为 loader 的耗时
+	set func(ctx context.Context, val T, cost time.Duration) error
+	// setNotFound 写入空值标记
+	setNotFound func(ctx context.Context) error
+}
+
+// load 加载并写入缓存，设置了 LockTTL 时先获取加载锁，未获得锁则等待其他实例写入缓存
+func (c *Cache[T]) load(ctx context.Context, key string, io cacheIO[T], loader func(ctx context.Context) (T, error)) (T, error) {
+	if c.opts.LockTTL > 0 {
+		lockKey := c.key(key) + ":loading"
+		token := newLockVal()
+		locked, err := c.r.setNX(ctx, lockKey, token, c.opts.LockTTL)
+		if err != nil {
+			log.Println(err)
+		}
+
+		if locked {
+			defer c.unlock(lockKey, token)
+
+			// 获得锁之前其他实例可能已经写入
+			val, ok, err := io.get(ctx)
+			if err == ErrNotFound || (err == nil && ok) {
+				return val, err
+			}
+		} else if err == nil {
+			val, ok, err := c.wait(ctx, io.get)
+			if ok || err == ErrNotFound {
+				return val, err
+			}
+		}
+	}
+
+	start := time.Now()
+	val, err := loader(ctx)
+	if errors.Is(err, ErrNotFound) && c.opts.NegativeTTL > 0 {
+		e := io.setNotFound(ctx)
+		if e != nil {
+			log.Println(e)
+		}
+		return val, err
+	}
+	if err != nil {
+		return val, err
+	}
+
+	err = io.set(ctx, val, time.Since(start))
+	if err != nil {
+		log.Println(err)
+	}
+	return val, nil
+}
+
+func (c *Cache[T]) unlock(lockKey, token string) {
+	err := c.r.freeLock(context.Background(), lockKey, token)
+	if err != nil && err != ErrLockNotOwned {
+		log.Println(err)
+	}
+}
+
+// wait 等待持有加载锁的实例写入缓存，超过 LockWait 返回 false，写入空值标记时返回 ErrNotFound
+func (c *Cache[T]) wait(ctx context.Context, get func(ctx context.Context) (T, bool, error)) (T, bool, error) {
+	var zero T
+	timer := time.NewTimer(c.opts.LockWait)
+	defer timer.Stop()
+	ticker := time.NewTicker(cacheLockPoll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return zero, false, nil
+		case <-timer.C:
+			return zero, false, nil
+		case <-ticker.C:
+			val, ok, err := get(ctx)
+			if err == ErrNotFound {
+				return zero, false, err
+			}
+			if err != nil {
+				log.Println(err)
+				return zero, false, nil
+			}
+			if ok {
+				return val, true, nil
+			}
+		}
+	}
+}
+
+type flightCall[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+}
+
+// flightGroup 合并同一个key的并发调用，只执行一次 fn，其他调用者等待并共享结果
+// fn 在独立的协程中执行，调用者的 ctx 结束时不影响 fn 和其他调用者
+type flightGroup[T any] struct {
+	mu sync.Mutex
+	m  map[string]*flightCall[T]
+}
+
+func (g *flightGroup[T]) do(ctx context.Context, key string, fn func() (T, error)) (T, error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*flightCall[T])
+	}
+	call, ok := g.m[key]
+	if !ok {
+		call = &flightCall[T]{
+			done: make(chan struct{}),
+		}
+		g.m[key] = call
+		go g.run(key, call, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.val, call.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+func (g *flightGroup[T]) run(key string, call *flightCall[T], fn func() (T, error)) {
+	defer func() {
+		if p := recover(); p != nil {
+			call.err = fmt.Errorf("redis cache load %s panic: %v", key, p)
+		}
+
+		g.mu.Lock()
+		delete(g.m, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.val, call.err = fn()
+}
@@ -0,0 +1,334 @@
+// Package redis tool
+package redis
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+)
+
+// LocalCacheOptions 进程内缓存参数
+type LocalCacheOptions struct {
+	// Size 最大条目数，超过后淘汰最久未使用的条目
+	Size int
+	// TTL 条目存活时间，也是失效通知丢失（如订阅重连期间）时脏数据的最长存活时间
+	TTL time.Duration
+	// Channel 失效通知频道，为空时为 "cache_invalidate:" + CacheOptions.Prefix
+	Channel string
+}
+
+var defaultLocalCacheOpts = LocalCacheOptions{
+	Size: 10000,
+	TTL:  time.Minute,
+}
+
+func DefaultLocalCacheOptions() LocalCacheOptions {
+	return defaultLocalCacheOpts
+}
+
+type lruEntry[T any] struct {
+	key    string
+	val    T
+	expire time.Time
+}
+
+// lruGenSlots 失效版本号的分片数
+const lruGenSlots = 256
+
+// lruCache 带过期时间的LRU
+// gens 为按key分片的版本号，set 和 del 时递增；从redis读取后通过 setIfVersion 写入，
+// 读取期间该key被写入或失效时放弃写入，避免新值或失效通知被旧值覆盖
+type lruCache[T any] struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	ll    *list.List
+	items map[string]*list.Element
+	gens  [lruGenSlots]uint64
+}
+
+func lruGenSlot(key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % lruGenSlots)
+}
+
+func newLRUCache[T any](size int, ttl time.Duration) *lruCache[T] {
+	return &lruCache[T]{
+		size:  size,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+func (c *lruCache[T]) get(key string) (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero T
+	e, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	entry := e.Value.(*lruEntry[T])
+	if !time.Now().Before(entry.expire) {
+		c.ll.Remove(e)
+		delete(c.items, key)
+		return zero, false
+	}
+	c.ll.MoveToFront(e)
+	return entry.val, true
+}
+
+// set 写入并递增版本号，之前读取的旧值不能再通过 setIfVersion 覆盖
+func (c *lruCache[T]) set(key string, val T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gens[lruGenSlot(key)]++
+	c.setLocked(key, val)
+}
+
+// version key 当前的版本号，在读取redis之前获取
+func (c *lruCache[T]) version(key string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gens[lruGenSlot(key)]
+}
+
+// setIfVersion key 的版本号仍为 ver 时写入，返回是否写入
+func (c *lruCache[T]) setIfVersion(key string, val T, ver uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gens[lruGenSlot(key)] != ver {
+		return false
+	}
+	c.setLocked(key, val)
+	return true
+}
+
+func (c *lruCache[T]) setLocked(key string, val T) {
+	expire := time.Now().Add(c.ttl)
+	if e, ok := c.items[key]; ok {
+		entry := e.Value.(*lruEntry[T])
+		entry.val = val
+		entry.expire = expire
+		c.ll.MoveToFront(e)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&lruEntry[T]{
+		key:    key,
+		val:    val,
+		expire: expire,
+	})
+	for c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*lruEntry[T]).key)
+	}
+}
+
+func (c *lruCache[T]) del(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		c.gens[lruGenSlot(key)]++
+		if e, ok := c.items[key]; ok {
+			c.ll.Remove(e)
+			delete(c.items, key)
+		}
+	}
+}
+
+func (c *lruCache[T]) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// invalidateMessage 失效通知，Source 为发送者实例ID，发送者忽略自己的通知
+type invalidateMessage struct {
+	Source string   `json:"source"`
+	Keys   []string `json:"keys"`
+}
+
+// TwoLevelCache 两级缓存：进程内LRU（L1）+ redis（L2）
+// 通过 TwoLevelCache 写入或删除时，通过 pub/sub 通知其他实例删除 L1 中的对应条目
+type TwoLevelCache[T any] struct {
+	cache   *Cache[T]
+	local   *lruCache[T]
+	channel string
+	id      string
+	sub     *Subscriber
+}
+
+// NewTwoLevelCache 创建两级缓存并订阅失效通知，使用完成后需要调用 Close
+func NewTwoLevelCache[T any](r *Redis, opts *CacheOptions, localOpts *LocalCacheOptions) (*TwoLevelCache[T], error) {
+	lo := defaultLocalCacheOpts
+	if localOpts != nil {
+		lo = *localOpts
+	}
+	if lo.Size <= 0 {
+		lo.Size = defaultLocalCacheOpts.Size
+	}
+	if lo.TTL <= 0 {
+		lo.TTL = defaultLocalCacheOpts.TTL
+	}
+
+	c := new(TwoLevelCache[T])
+	c.cache = NewCache[T](r, opts)
+	c.local = newLRUCache[T](lo.Size, lo.TTL)
+	c.channel = lo.Channel
+	if c.channel == "" {
+		c.channel = "cache_invalidate:" + c.cache.opts.Prefix
+	}
+	c.id = newLockVal()
+
+	c.sub = r.NewSubscriber()
+	err := c.sub.Subscribe(r.ctx, c.onInvalidate, c.channel)
+	if err != nil {
+		_ = c.sub.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *TwoLevelCache[T]) onInvalidate(_ context.Context, msg *PubSubMessage) {
+	var m invalidateMessage
+	err := json.Unmarshal([]byte(msg.Payload), &m)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if m.Source == c.id {
+		return
+	}
+	c.local.del(m.Keys...)
+}
+
+// publish 通知其他实例删除 L1 条目
+func (c *TwoLevelCache[T]) publish(ctx context.Context, keys []string) error {
+	_, err := c.cache.r.PublishJSON(ctx, c.channel, invalidateMessage{
+		Source: c.id,
+		Keys:   keys,
+	})
+	return err
+}
+
+// Get 先读 L1，不存在时读 redis 并写入 L1，空值标记返回 ErrNotFound
+// 读取redis期间收到该key的失效通知时不写入 L1
+func (c *TwoLevelCache[T]) Get(ctx context.Context, key string) (T, bool, error) {
+	fullKey := c.cache.key(key)
+	if val, ok := c.local.get(fullKey); ok {
+		return val, true, nil
+	}
+
+	ver := c.local.version(fullKey)
+	val, ok, err := c.cache.Get(ctx, key)
+	if err != nil || !ok {
+		return val, ok, err
+	}
+	c.local.setIfVersion(fullKey, val, ver)
+	return val, true, nil
+}
+
+// Set 写入 redis 和 L1，并通知其他实例删除 L1 条目
+func (c *TwoLevelCache[T]) Set(ctx context.Context, key string, val T, ttl time.Duration) error {
+	err := c.cache.Set(ctx, key, val, ttl)
+	if err != nil {
+		return err
+	}
+
+	fullKey := c.cache.key(key)
+	c.local.set(fullKey, val)
+	return c.publish(c.cache.context(ctx), []string{fullKey})
+}
+
+// SetNotFound 写入空值标记，并删除所有实例 L1 中的条目
+func (c *TwoLevelCache[T]) SetNotFound(ctx context.Context, key string, ttl time.Duration) error {
+	err := c.cache.SetNotFound(ctx, key, ttl)
+	if err != nil {
+		return err
+	}
+	return c.Invalidate(ctx, key)
+}
+
+// Delete 删除 redis 和 L1 中的条目，并通知其他实例删除 L1 条目
+func (c *TwoLevelCache[T]) Delete(ctx context.Context, key ...string) error {
+	if len(key) <= 0 {
+		return nil
+	}
+
+	err := c.cache.Delete(ctx, key...)
+	if err != nil {
+		return err
+	}
+	return c.Invalidate(ctx, key...)
+}
+
+// Invalidate 只删除所有实例 L1 中的条目，redis 中的数据已由其他方式更新时调用
+func (c *TwoLevelCache[T]) Invalidate(ctx context.Context, key ...string) error {
+	if len(key) <= 0 {
+		return nil
+	}
+
+	keys := make([]string, len(key))
+	for i, k := range key {
+		keys[i] = c.cache.key(k)
+	}
+	c.local.del(keys...)
+	return c.publish(c.cache.context(ctx), keys)
+}
+
+// GetOrLoad 依次读取 L1、redis，都不存在时调用 loader 加载，加载方式与 Cache.GetOrLoad 相同
+// 加载的值写入 redis 和 L1，并通知其他实例删除 L1 条目；读取或加载期间收到该key的失效通知时不写入 L1
+func (c *TwoLevelCache[T]) GetOrLoad(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	fullKey := c.cache.key(key)
+	if val, ok := c.local.get(fullKey); ok {
+		return val, nil
+	}
+
+	ver := c.local.version(fullKey)
+	loaded := false
+	val, err := c.cache.GetOrLoad(ctx, key, ttl, func(ctx context.Context) (T, error) {
+		loaded = true
+		return loader(ctx)
+	})
+	if err != nil {
+		// 数据已不存在，其他实例 L1 中的旧值同时失效
+		// loaded 在加载协程中写入，只有加载完成（err 来自 loader）时才能读取
+		if errors.Is(err, ErrNotFound) && loaded {
+			e := c.Invalidate(ctx, key)
+			if e != nil {
+				log.Println(e)
+			}
+		}
+		return val, err
+	}
+
+	c.local.setIfVersion(fullKey, val, ver)
+	if loaded {
+		err = c.publish(c.cache.context(ctx), []string{fullKey})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	return val, nil
+}
+
+// LocalLen L1 中的条目数，包含已过期但尚未淘汰的条目
+func (c *TwoLevelCache[T]) LocalLen() int {
+	return c.local.len()
+}
+
+// Close 取消失效通知订阅
+func (c *TwoLevelCache[T]) Close() error {
+	return c.sub.Close()
+}
@@ -0,0 +1,104 @@
+// Package redis tool
+package redis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUCacheEviction(t *testing.T) {
+	c := newLRUCache[int](2, time.Minute)
+	c.set("a", 1)
+	c.set("b", 2)
+	// 访问 a 后 b 最久未使用
+	if v, ok := c.get("a"); !ok || v != 1 {
+		t.Errorf("get a got %v %v, want 1 true", v, ok)
+	}
+	c.set("c", 3)
+
+	if _, ok := c.get("b"); ok {
+		t.Error("b should be evicted")
+	}
+	if v, ok := c.get("a"); !ok || v != 1 {
+		t.Errorf("get a got %v %v, want 1 true", v, ok)
+	}
+	if v, ok := c.get("c"); !ok || v != 3 {
+		t.Errorf("get c got %v %v, want 3 true", v, ok)
+	}
+	if c.len() != 2 {
+		t.Errorf("len got %d, want 2", c.len())
+	}
+
+	// 更新已有的key不淘汰其他条目
+	c.set("a", 10)
+	if v, _ := c.get("a"); v != 10 || c.len() != 2 {
+		t.Errorf("get a got %v len %d, want 10 len 2", v, c.len())
+	}
+}
+
+func TestLRUCacheTTL(t *testing.T) {
+	c := newLRUCache[string](10, 20*time.Millisecond)
+	c.set("a", "x")
+	if _, ok := c.get("a"); !ok {
+		t.Error("a should not expire yet")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := c.get("a"); ok {
+		t.Error("a should expire")
+	}
+	if c.len() != 0 {
+		t.Errorf("expired entry should be removed on get, len %d", c.len())
+	}
+}
+
+func TestLRUCacheDel(t *testing.T) {
+	c := newLRUCache[int](10, time.Minute)
+	c.set("a", 1)
+	c.set("b", 2)
+	c.del("a", "missing")
+
+	if _, ok := c.get("a"); ok {
+		t.Error("a should be deleted")
+	}
+	if _, ok := c.get("b"); !ok {
+		t.Error("b should not be deleted")
+	}
+	if c.len() != 1 {
+		t.Errorf("len got %d, want 1", c.len())
+	}
+}
+
+func TestLRUCacheSetIfVersion(t *testing.T) {
+	c := newLRUCache[int](10, time.Minute)
+
+	ver := c.version("a")
+	if !c.setIfVersion("a", 1, ver) {
+		t.Error("setIfVersion should succeed without invalidation")
+	}
+
+	// 读取期间被失效，旧值不能写入
+	ver = c.version("a")
+	c.del("a")
+	if c.setIfVersion("a", 2, ver) {
+		t.Error("setIfVersion should fail after del")
+	}
+	if _, ok := c.get("a"); ok {
+		t.Error("a should not be cached after a failed setIfVersion")
+	}
+
+	ver = c.version("a")
+	if !c.setIfVersion("a", 3, ver) {
+		t.Error("setIfVersion should succeed with the new version")
+	}
+
+	// 读取期间本进程写入了新值，旧值不能覆盖
+	ver = c.version("a")
+	c.set("a", 4)
+	if c.setIfVersion("a", 3, ver) {
+		t.Error("setIfVersion should fail after set")
+	}
+	if v, _ := c.get("a"); v != 4 {
+		t.Errorf("get a got %v, want 4", v)
+	}
+}
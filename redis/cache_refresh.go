@@ -0,0 +1,232 @@
+// Package redis tool
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	v8 "github.com/go-redis/redis/v8"
+)
+
+// RefreshOptions 软过期缓存参数
+type RefreshOptions struct {
+	// Soft 软过期时间，超过后仍返回旧值，并在后台刷新
+	Soft time.Duration
+	// Hard 硬过期时间，即redis key的过期时间，超过后只能同步加载，必须大于 Soft，为0时为 Soft 的 refreshHardFactor 倍
+	// Soft 与 Hard 之间为返回旧值并后台刷新的时间段
+	Hard time.Duration
+	// Beta XFetch 提前刷新系数，大于0时软过期之前按概率提前在后台刷新，加载越慢、越接近软过期，概率越大
+	// 通常取1，越大越早刷新，0 表示不提前刷新
+	Beta float64
+}
+
+// refreshHardFactor 未设置 Hard 时，Hard 为 Soft 的倍数
+const refreshHardFactor = 5
+
+// cacheEntry 带软过期时间的缓存值，存储格式为 "软过期毫秒时间戳:加载耗时毫秒:序列化后的值"
+// 空值标记的值为 cacheNilMarker
+type cacheEntry[T any] struct {
+	val      T
+	soft     time.Time
+	cost     time.Duration
+	notFound bool
+}
+
+func (c *Cache[T]) getEntry(ctx context.Context, key string) (*cacheEntry[T], error) {
+	data, err := c.r.cli.Get(c.context(ctx), c.key(key)).Result()
+	if err == v8.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	soft, rest, ok1 := strings.Cut(data, ":")
+	cost, payload, ok2 := strings.Cut(rest, ":")
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("redis cache entry format error: %s", key)
+	}
+	softMs, err := strconv.ParseInt(soft, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	costMs, err := strconv.ParseInt(cost, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &cacheEntry[T]{
+		soft: time.UnixMilli(softMs),
+		cost: time.Duration(costMs) * time.Millisecond,
+	}
+	if payload == cacheNilMarker {
+		entry.notFound = true
+		return entry, nil
+	}
+	err = c.opts.Codec.Unmarshal([]byte(payload), &entry.val)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (c *Cache[T]) setEntry(ctx context.Context, key string, val T, cost time.Duration, opts RefreshOptions) error {
+	data, err := c.opts.Codec.Marshal(val)
+	if err != nil {
+		return err
+	}
+
+	header := fmt.Sprintf("%d:%d:", time.Now().Add(opts.Soft).UnixMilli(), cost.Milliseconds())
+	return c.r.cli.Set(c.context(ctx), c.key(key), append([]byte(header), data...), opts.Hard).Err()
+}
+
+// setNotFoundEntry 写入空值标记，软过期与硬过期均为 NegativeTTL
+func (c *Cache[T]) setNotFoundEntry(ctx context.Context, key string) error {
+	ttl := c.opts.NegativeTTL
+	header := fmt.Sprintf("%d:0:", time.Now().Add(ttl).UnixMilli())
+	return c.r.cli.Set(c.context(ctx), c.key(key), header+cacheNilMarker, ttl).Err()
+}
+
+// shouldRefresh 软过期后需要刷新；设置了 Beta 时按 XFetch 算法提前刷新：
+// now - cost * beta * ln(rand) >= soft
+func (e *cacheEntry[T]) shouldRefresh(now time.Time, beta float64) bool {
+	if !now.Before(e.soft) {
+		return true
+	}
+	if beta <= 0 || e.cost <= 0 {
+		return false
+	}
+
+	gap := -float64(e.cost) * beta * math.Log(1-rand.Float64())
+	return !now.Add(time.Duration(gap)).Before(e.soft)
+}
+
+// GetOrRefresh 读取软过期缓存：
+// 未超过软过期时直接返回；超过软过期（或被 XFetch 选中提前刷新）时返回旧值，并在后台刷新，同一个key同时只有一个刷新
+// 缓存不存在（超过硬过期）时同步加载，加载方式与 GetOrLoad 相同
+// 空值标记在 NegativeTTL 后过期，期间返回 ErrNotFound，不在后台刷新
+// 同一个key只能使用 GetOrRefresh 或 GetOrLoad 之一，两者的存储格式不同
+func (c *Cache[T]) GetOrRefresh(ctx context.Context, key string, opts RefreshOptions, loader func(ctx context.Context) (T, error)) (T, error) {
+	if opts.Soft <= 0 {
+		var zero T
+		return zero, fmt.Errorf("redis cache soft expiration must gt 0")
+	}
+	if opts.Hard == 0 {
+		opts.Hard = opts.Soft * refreshHardFactor
+	}
+	if opts.Hard <= opts.Soft {
+		var zero T
+		return zero, fmt.Errorf("redis cache hard expiration must gt soft expiration")
+	}
+
+	ctx = c.context(ctx)
+	entry, err := c.getEntry(ctx, key)
+	if err != nil {
+		log.Println(err)
+	}
+	if entry != nil && entry.notFound {
+		return entry.val, ErrNotFound
+	}
+	if entry != nil {
+		if entry.shouldRefresh(time.Now(), opts.Beta) {
+			c.refresh(key, opts, loader)
+		}
+		return entry.val, nil
+	}
+
+	io := cacheIO[T]{
+		get: func(ctx context.Context) (T, bool, error) {
+			entry, err := c.getEntry(ctx, key)
+			if err != nil || entry == nil {
+				var zero T
+				return zero, false, err
+			}
+			if entry.notFound {
+				return entry.val, false, ErrNotFound
+			}
+			return entry.val, true, nil
+		},
+		set: func(ctx context.Context, val T, cost time.Duration) error {
+			return c.setEntry(ctx, key, val, cost, opts)
+		},
+		setNotFound: func(ctx context.Context) error {
+			return c.setNotFoundEntry(ctx, key)
+		},
+	}
+	return c.shareLoad(ctx, key, io, loader)
+}
+
+// refresh 后台刷新，进程内同一个key同时只有一个刷新，设置了 LockTTL 时跨实例也只有一个
+// 未获得刷新锁时直接放弃，由持有锁的实例刷新；数据已不存在（loader 返回 ErrNotFound）且设置了 NegativeTTL 时写入空值标记
+// 刷新超过 LoadTimeout 视为失败，之后的读取可以再次触发刷新，超时后 loader 的结果不再写入
+func (c *Cache[T]) refresh(key string, opts RefreshOptions, loader func(ctx context.Context) (T, error)) {
+	if _, loaded := c.refreshing.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+
+	go func() {
+		defer c.refreshing.Delete(key)
+
+		ctx, cancel := context.WithTimeout(c.r.ctx, c.opts.LoadTimeout)
+		defer cancel()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.doRefresh(ctx, key, opts, loader)
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			log.Println(fmt.Errorf("redis cache refresh %s: %w", key, ctx.Err()))
+		}
+	}()
+}
+
+func (c *Cache[T]) doRefresh(ctx context.Context, key string, opts RefreshOptions, loader func(ctx context.Context) (T, error)) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Println(fmt.Errorf("redis cache refresh %s panic: %v", key, p))
+		}
+	}()
+
+	if c.opts.LockTTL > 0 {
+		lockKey := c.key(key) + ":refreshing"
+		token := newLockVal()
+		locked, err := c.r.setNX(ctx, lockKey, token, c.opts.LockTTL)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if !locked {
+			return
+		}
+		defer c.unlock(lockKey, token)
+	}
+
+	start := time.Now()
+	val, err := loader(ctx)
+	if errors.Is(err, ErrNotFound) && c.opts.NegativeTTL > 0 {
+		err = c.setNotFoundEntry(ctx, key)
+		if err != nil {
+			log.Println(err)
+		}
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	err = c.setEntry(ctx, key, val, time.Since(start), opts)
+	if err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,246 @@
+// Package redis tool
+package redis
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	v8 "github.com/go-redis/redis/v8"
+)
+
+// leaderScript 原子地竞选或续期领导者
+// key 不存在时成为领导者并递增任期（栅栏令牌），自己是领导者时续期
+// KEYS: 领导者key、任期计数key
+// ARGV: 身份标识、租期毫秒
+// 返回 {状态(0 跟随者/1 新当选/2 续期), 任期, 当前领导者}
+var leaderScript = v8.NewScript(`
+local cur = redis.call("GET", KEYS[1])
+if cur == false then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return {1, redis.call("INCR", KEYS[2]), ARGV[1]}
+end
+if cur == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return {2, tonumber(redis.call("GET", KEYS[2]) or "0") or 0, cur}
+end
+return {0, 0, cur}
+`)
+
+type leaderState struct {
+	status int64
+	fence  int64
+	leader string
+}
+
+func (r *Redis) campaign(ctx context.Context, key, identity string, lease time.Duration) (leaderState, error) {
+	ret, err := leaderScript.Run(ctx, r.cli, []string{key, r.hashTagKey(key, ":term")}, identity, lease.Milliseconds()).Slice()
+	if err != nil {
+		return leaderState{}, err
+	}
+	if len(ret) != 3 {
+		return leaderState{}, fmt.Errorf("redis leader script result error: %v", ret)
+	}
+
+	status, _ := ret[0].(int64)
+	fence, _ := ret[1].(int64)
+	leader, _ := ret[2].(string)
+	return leaderState{
+		status: status,
+		fence:  fence,
+		leader: leader,
+	}, nil
+}
+
+// LeaderCallbacks 领导者选举回调
+type LeaderCallbacks struct {
+	// OnStartedLeading 当选后在新的协程中调用，失去领导权时 ctx 被取消，可通过 FenceFromContext 读取任期
+	OnStartedLeading func(ctx context.Context)
+	// OnStoppedLeading 失去领导权（续期失败、主动让位或 Run 结束）时调用
+	OnStoppedLeading func()
+	// OnNewLeader 观察到领导者变化时调用，identity 为空表示当前没有领导者
+	OnNewLeader func(identity string)
+}
+
+// LeaderElector 基于redis的领导者选举，后台循环竞选和续期
+type LeaderElector struct {
+	r         *Redis
+	key       string
+	identity  string
+	lease     time.Duration
+	callbacks LeaderCallbacks
+
+	mu       sync.RWMutex
+	leader   string
+	fence    int64
+	leading  bool
+	cancel   context.CancelFunc
+	stepDown chan struct{}
+}
+
+// NewLeaderElector 创建领导者选举，identity 为本实例的唯一标识，lease 为领导者租期
+// 领导者每 lease/3 续期一次，超过续期截止时间（lease*2/3）未续期成功即放弃领导权，
+// 保证在租期过期、其他实例当选之前本实例已取消 OnStartedLeading 的 ctx
+func (r *Redis) NewLeaderElector(key, identity string, lease time.Duration, callbacks LeaderCallbacks) *LeaderElector {
+	if identity == "" || lease <= 0 {
+		panic("identity must not be empty and lease must gt 0")
+	}
+
+	e := new(LeaderElector)
+	e.r = r
+	e.key = key
+	e.identity = identity
+	e.lease = lease
+	e.callbacks = callbacks
+	e.stepDown = make(chan struct{}, 1)
+	return e
+}
+
+// Leader 当前观察到的领导者标识
+func (e *LeaderElector) Leader() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leader
+}
+
+// IsLeader 本实例是否为领导者
+func (e *LeaderElector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leading
+}
+
+// Fence 本实例当前任期的栅栏令牌，非领导者返回0
+func (e *LeaderElector) Fence() int64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.fence
+}
+
+// StepDown 主动让出领导权，让位后等待一个租期再重新参与竞选
+func (e *LeaderElector) StepDown() {
+	select {
+	case e.stepDown <- struct{}{}:
+	default:
+	}
+}
+
+func (e *LeaderElector) setLeader(leader string) {
+	e.mu.Lock()
+	changed := e.leader != leader
+	e.leader = leader
+	e.mu.Unlock()
+
+	if changed && e.callbacks.OnNewLeader != nil {
+		e.callbacks.OnNewLeader(leader)
+	}
+}
+
+func (e *LeaderElector) startLeading(ctx context.Context, fence int64) {
+	leadCtx, cancel := context.WithCancel(context.WithValue(ctx, fenceCtxKey{}, fence))
+
+	e.mu.Lock()
+	e.leading = true
+	e.fence = fence
+	e.cancel = cancel
+	e.mu.Unlock()
+
+	if e.callbacks.OnStartedLeading != nil {
+		go e.callbacks.OnStartedLeading(leadCtx)
+	}
+}
+
+func (e *LeaderElector) stopLeading(release bool) {
+	e.mu.Lock()
+	if !e.leading {
+		e.mu.Unlock()
+		return
+	}
+	e.leading = false
+	e.fence = 0
+	e.cancel()
+	e.mu.Unlock()
+
+	if release {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(3)*time.Second)
+		err := e.r.freeLock(ctx, e.key, e.identity)
+		cancel()
+		if err == nil {
+			e.setLeader("")
+		} else {
+			log.Println(err)
+		}
+	}
+
+	if e.callbacks.OnStoppedLeading != nil {
+		e.callbacks.OnStoppedLeading()
+	}
+}
+
+// Run 循环竞选和续期，直到 ctx 结束；结束时如果是领导者则释放领导权
+func (e *LeaderElector) Run(ctx context.Context) error {
+	if ctx == nil {
+		ctx = e.r.ctx
+	}
+
+	retry := e.lease / 3
+	renewDeadline := e.lease * 2 / 3
+	ticker := time.NewTicker(retry)
+	defer ticker.Stop()
+
+	lastRenew := time.Time{}
+	for {
+		// 领导者的续期请求不能超过续期截止时间
+		timeout := retry
+		if e.IsLeader() {
+			remaining := renewDeadline - time.Since(lastRenew)
+			if remaining <= 0 {
+				e.stopLeading(false)
+			} else if remaining < timeout {
+				timeout = remaining
+			}
+		}
+
+		// 成功时租期从请求发出之前算起，偏保守
+		start := time.Now()
+		opCtx, cancel := context.WithTimeout(ctx, timeout)
+		state, err := e.r.campaign(opCtx, e.key, e.identity, e.lease)
+		cancel()
+
+		switch {
+		case err != nil:
+			log.Println(err)
+			if e.IsLeader() && time.Since(lastRenew) >= renewDeadline {
+				e.stopLeading(false)
+			}
+		case state.status == 0:
+			e.stopLeading(false)
+			e.setLeader(state.leader)
+		default:
+			lastRenew = start
+			e.setLeader(state.leader)
+			if state.status == 1 || !e.IsLeader() {
+				e.stopLeading(false)
+				e.startLeading(ctx, state.fence)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			e.stopLeading(true)
+			return ctx.Err()
+		case <-e.stepDown:
+			e.stopLeading(true)
+			timer := time.NewTimer(e.lease)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		case <-ticker.C:
+		}
+	}
+}
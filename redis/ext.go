@@ -3,21 +3,61 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"time"
 
-	"github.com/assembly-hub/basics/util"
+	v8 "github.com/go-redis/redis/v8"
 )
 
-// GetLock 获取redis锁，成功返回nil，否则返回对应error
-func (r *Redis) GetLock(key string, lockVal *string, exp int) error {
+// ErrLockNotOwned 释放锁时，锁已过期或已被其他持有者获取
+var ErrLockNotOwned = errors.New("redis lock is not owned")
+
+// freeLockScript 仅当锁的值与持有者令牌一致时删除
+var freeLockScript = v8.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// registerScript 原子地注册或续期 Register 的主服务标识，不维护任期计数
+// ARGV: 身份标识、过期毫秒，小于等于0时不过期
+// 返回 1 注册或续期成功，0 已被其他标识注册
+var registerScript = v8.NewScript(`
+local exp = tonumber(ARGV[2])
+local cur = redis.call("GET", KEYS[1])
+if cur == false then
+	if exp > 0 then
+		redis.call("SET", KEYS[1], ARGV[1], "PX", exp)
+	else
+		redis.call("SET", KEYS[1], ARGV[1])
+	end
+	return 1
+end
+if cur == ARGV[1] then
+	if exp > 0 then
+		redis.call("PEXPIRE", KEYS[1], exp)
+	end
+	return 1
+end
+return 0
+`)
+
+func newLockVal() string {
+	return fmt.Sprintf("%v-%08v", time.Now().UnixNano(), rand.New(rand.NewSource(time.Now().UnixNano())).Int63n(100000000))
+}
+
+// GetLock 获取redis锁，成功返回持有者令牌和nil，否则返回对应error
+// 不提供栅栏令牌，需要时使用 ObtainLock 并开启 LockOptions.Fencing
+func (r *Redis) GetLock(key string, lockVal *string, exp int) (string, error) {
 	val := ""
 	if lockVal != nil {
 		val = *lockVal
 	} else {
-		val = fmt.Sprintf("%v-%08v", time.Now().UnixNano(), rand.New(rand.NewSource(time.Now().UnixNano())).Int63n(100000000))
+		val = newLockVal()
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(3)*time.Second)
@@ -25,22 +65,22 @@ func (r *Redis) GetLock(key string, lockVal *string, exp int) error {
 
 	ok, err := r.SetNxSec(ctx, key, val, exp)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if !ok {
-		return fmt.Errorf("add lock is failed")
+		return "", fmt.Errorf("add lock is failed")
 	}
-	return nil
+	return val, nil
 }
 
-// TryLock 尝试获取redis锁，指定重试次数和重试间隔，成功返回nil，否则返回对应error
-func (r *Redis) TryLock(key string, lockVal *string, exp int, maxTryTime int, intervalMs int64) error {
+// TryLock 尝试获取redis锁，指定重试次数和重试间隔，成功返回持有者令牌和nil，否则返回对应error
+func (r *Redis) TryLock(key string, lockVal *string, exp int, maxTryTime int, intervalMs int64) (string, error) {
 	val := ""
 	if lockVal != nil {
 		val = *lockVal
 	} else {
-		val = fmt.Sprintf("%v-%08v", time.Now().UnixNano(), rand.New(rand.NewSource(time.Now().UnixNano())).Int63n(100000000))
+		val = newLockVal()
 	}
 
 	if maxTryTime < 0 {
@@ -51,143 +91,90 @@ func (r *Redis) TryLock(key string, lockVal *string, exp int, maxTryTime int, in
 		intervalMs = 100
 	}
 
-	err := r.GetLock(key, &val, exp)
+	_, err := r.GetLock(key, &val, exp)
 	if err != nil && maxTryTime > 0 {
 		for i := 0; i < maxTryTime; i++ {
 			time.Sleep(time.Duration(intervalMs) * time.Millisecond)
-			err = r.GetLock(key, &val, exp)
+			_, err = r.GetLock(key, &val, exp)
 			if err == nil {
 				break
 			}
 		}
 	}
 
-	return err
+	if err != nil {
+		return "", err
+	}
+	return val, nil
 }
 
 // WithLock 尝试获取redis锁，指定重试次数和重试间隔，获取成功之后执行 fun，否则不执行
+// fun 执行期间锁会自动续期
 func (r *Redis) WithLock(key string, lockVal *string, exp int, maxTryTime int, intervalMs int64, fun func()) {
-	err := r.TryLock(key, lockVal, exp, maxTryTime, intervalMs)
+	r.WithLockRenew(key, lockVal, exp, maxTryTime, intervalMs, func(ctx context.Context) {
+		fun()
+	})
+}
+
+// WithLockRenew 同 WithLock，fun 接收锁的 context，锁丢失时 context 被取消
+func (r *Redis) WithLockRenew(key string, lockVal *string, exp int, maxTryTime int, intervalMs int64, fun func(ctx context.Context)) {
+	l, err := r.AcquireLock(key, lockVal, exp, maxTryTime, intervalMs)
 	if err != nil {
 		panic(err)
 	}
 	defer func() {
-		e := r.FreeLock(key)
+		e := l.Release()
 		if e != nil {
 			log.Println(e)
 		}
 	}()
 
-	fun()
+	fun(l.Context())
 }
 
-// FreeLock 释放指定的redis锁
-func (r *Redis) FreeLock(key string) error {
+// FreeLock 释放指定的redis锁，仅当锁仍由 lockVal 持有时释放，否则返回 ErrLockNotOwned
+func (r *Redis) FreeLock(key string, lockVal string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(3)*time.Second)
 	defer cancel()
 
-	_, err := r.Del(ctx, key)
+	return r.freeLock(ctx, key, lockVal)
+}
+
+func (r *Redis) freeLock(ctx context.Context, key string, lockVal string) error {
+	ret, err := freeLockScript.Run(ctx, r.cli, []string{key}, lockVal).Int64()
 	if err != nil {
 		return err
 	}
 
+	if ret == 0 {
+		return ErrLockNotOwned
+	}
 	return nil
 }
 
 // Register 注册HA 主服务标识，注册成功返回true，否则返回false
+// 竞选与续期在一个Lua脚本中原子完成，exp <= 0 时不过期；需要持续续期或任期（栅栏令牌）时使用 LeaderElector
 func (r *Redis) Register(key string, val string, exp int) bool {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(3)*time.Second)
-	_, err := r.SetNxSec(ctx, key, val, exp)
-	cancel()
-	if err != nil {
-		log.Println(err)
-		return false
-	}
+	defer cancel()
 
-	ctx, cancel = context.WithTimeout(context.Background(), time.Duration(3)*time.Second)
-	redisVal, err := r.Get(ctx, key)
-	cancel()
+	ret, err := registerScript.Run(ctx, r.cli, []string{key}, val, (time.Duration(exp) * time.Second).Milliseconds()).Int64()
 	if err != nil {
 		log.Println(err)
 		return false
 	}
-
-	if redisVal == val {
-		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(3)*time.Second)
-		_, err = r.SetXxSec(ctx, key, val, exp)
-		cancel()
-		if err != nil {
-			log.Println(err)
-		}
-		return true
-	}
-	return false
+	return ret == 1
 }
 
 // QuotaLimit 资源量限制，被限制返回true，否则返回false
+// 检查与累加在一个Lua脚本中原子完成，addLock 参数已不再需要，保留仅为兼容；出错时视为被限制
 func (r *Redis) QuotaLimit(limitKay string, maxCount int, exp int, addCount int, addLock bool) bool {
-	if maxCount < addCount {
-		return true
-	}
-
-	innerFunc := func(red *Redis) bool {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(3)*time.Second)
-		keyTime, err := red.TTL(ctx, limitKay)
-		cancel()
-		if err != nil {
-			log.Println(err)
-			return true
-		}
-
-		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(3)*time.Second)
-		limitCount, err := red.Get(ctx, limitKay)
-		cancel()
-		if err != nil {
-			log.Println(err)
-			return true
-		}
-
-		if limitCount != "" && keyTime > 0 {
-			lc, err := util.Str2Int[int](limitCount)
-			if err != nil {
-				log.Println(err)
-				return true
-			}
-			if lc >= maxCount {
-				return true
-			}
-
-			if keyTime > 0 {
-				exp = int(keyTime)
-			}
-			addCount += lc
-		}
-
-		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(3)*time.Second)
-		err = red.SetEx(ctx, limitKay, util.IntToStr(addCount), exp)
-		cancel()
-		if err != nil {
-			log.Println(err)
-			return true
-		}
-
-		return false
-	}
-
-	if addLock {
-		lockKey := "redis_lock_" + limitKay
-		err := r.TryLock(lockKey, nil, 3, 5, 200)
-		if err != nil {
-			return true
-		}
-		defer func() {
-			e := r.FreeLock(lockKey)
-			if e != nil {
-				log.Println(e)
-			}
-		}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(3)*time.Second)
+	defer cancel()
 
-		return innerFunc(r)
+	ret, err := r.QuotaTake(ctx, limitKay, int64(maxCount), int64(addCount), time.Duration(exp)*time.Second, QuotaFailClosed)
+	if err != nil {
+		log.Println(err)
 	}
-	return innerFunc(r)
+	return ret.Limited
 }
@@ -0,0 +1,261 @@
+// Package redis tool
+package redis
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hashTag 结构体与hash映射使用的tag，格式：`redis:"field_name,omitempty"`，"-" 表示忽略
+const hashTag = "redis"
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+type hashField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// hashFields 解析结构体中带 redis tag 的字段，匿名嵌入的结构体字段展开
+func hashFields(t reflect.Type, parent []int) []hashField {
+	fields := make([]hashField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		index := append(append([]int{}, parent...), i)
+
+		tag, ok := f.Tag.Lookup(hashTag)
+		if !ok {
+			if f.Anonymous && f.Type.Kind() == reflect.Struct {
+				fields = append(fields, hashFields(f.Type, index)...)
+			}
+			continue
+		}
+		if tag == "-" || !f.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, hashField{
+			name:      name,
+			index:     index,
+			omitEmpty: opts == "omitempty",
+		})
+	}
+	return fields
+}
+
+func structValue(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return reflect.Value{}, fmt.Errorf("redis hash struct must not be nil")
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("redis hash struct type error: %T", v)
+	}
+	return rv, nil
+}
+
+// encodeHashValue 字段值转换为hash中存储的字符串
+func encodeHashValue(v reflect.Value) (string, error) {
+	if v.Type().Implements(textMarshalerType) {
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+	}
+
+	b, err := json.Marshal(v.Interface())
+	return string(b), err
+}
+
+// decodeHashValue hash中的字符串写入字段
+func decodeHashValue(s string, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeHashValue(s, v.Elem())
+	}
+
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			if d, err := time.ParseDuration(s); err == nil {
+				v.SetInt(int64(d))
+				return nil
+			}
+		}
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(i)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(s))
+			return nil
+		}
+	}
+
+	return json.Unmarshal([]byte(s), v.Addr().Interface())
+}
+
+// StructToHash 结构体转换为hash字段，只处理带 redis tag 的导出字段
+// 基础类型按字符串存储，实现 encoding.TextMarshaler 的类型使用 MarshalText，其他类型使用json
+func StructToHash(v interface{}) (map[string]interface{}, error) {
+	rv, err := structValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := hashFields(rv.Type(), nil)
+	ret := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		fv, err := rv.FieldByIndexErr(f.index)
+		if err != nil {
+			continue
+		}
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+
+		s, err := encodeHashValue(fv)
+		if err != nil {
+			return nil, fmt.Errorf("redis hash field %s encode error: %w", f.name, err)
+		}
+		ret[f.name] = s
+	}
+	return ret, nil
+}
+
+// HashToStruct hash字段写入结构体，v 必须是结构体指针，hash中不存在的字段保持不变
+func HashToStruct(data map[string]string, v interface{}) error {
+	if reflect.ValueOf(v).Kind() != reflect.Ptr {
+		return fmt.Errorf("redis hash struct must be a pointer: %T", v)
+	}
+	rv, err := structValue(v)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range hashFields(rv.Type(), nil) {
+		s, ok := data[f.name]
+		if !ok {
+			continue
+		}
+
+		fv := rv
+		for _, i := range f.index {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+				fv = fv.Elem()
+			}
+			fv = fv.Field(i)
+		}
+
+		err = decodeHashValue(s, fv)
+		if err != nil {
+			return fmt.Errorf("redis hash field %s decode error: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// HSetStruct 结构体写入hash，字段映射见 StructToHash
+func (r *Redis) HSetStruct(ctx context.Context, key string, v interface{}) (int64, error) {
+	values, err := StructToHash(v)
+	if err != nil {
+		return 0, err
+	}
+	if len(values) <= 0 {
+		return 0, nil
+	}
+
+	return r.HSet(ctx, key, values)
+}
+
+// HGetStruct 读取hash写入结构体指针 v，key 不存在时返回 false
+func (r *Redis) HGetStruct(ctx context.Context, key string, v interface{}) (bool, error) {
+	data, err := r.HGetAll(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if len(data) <= 0 {
+		return false, nil
+	}
+
+	err = HashToStruct(data, v)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,132 @@
+// Package redis tool
+package redis
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type hashBase struct {
+	ID      int64     `redis:"id"`
+	Created time.Time `redis:"created"`
+}
+
+type hashProfile struct {
+	City string `json:"city"`
+	Zip  int    `json:"zip"`
+}
+
+type hashUser struct {
+	hashBase
+	Name    string        `redis:"name"`
+	Nick    string        `redis:"nick,omitempty"`
+	Age     *int          `redis:"age"`
+	Score   float64       `redis:"score"`
+	Active  bool          `redis:"active"`
+	TTL     time.Duration `redis:"ttl"`
+	Avatar  []byte        `redis:"avatar"`
+	Tags    []string      `redis:"tags"`
+	Profile hashProfile   `redis:"profile"`
+	Ignored string        `redis:"-"`
+	NoTag   string
+}
+
+func TestStructToHashRoundTrip(t *testing.T) {
+	age := 18
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	cases := []struct {
+		name string
+		in   hashUser
+		want map[string]interface{}
+	}{
+		{
+			name: "all fields",
+			in: hashUser{
+				hashBase: hashBase{ID: 1, Created: created},
+				Name:     "tom",
+				Nick:     "t",
+				Age:      &age,
+				Score:    9.5,
+				Active:   true,
+				TTL:      1500 * time.Millisecond,
+				Avatar:   []byte("png"),
+				Tags:     []string{"a", "b"},
+				Profile:  hashProfile{City: "sh", Zip: 200000},
+			},
+			want: map[string]interface{}{
+				"id":      "1",
+				"created": "2024-01-02T03:04:05Z",
+				"name":    "tom",
+				"nick":    "t",
+				"age":     "18",
+				"score":   "9.5",
+				"active":  "true",
+				"ttl":     "1500000000",
+				"avatar":  "png",
+				"tags":    `["a","b"]`,
+				"profile": `{"city":"sh","zip":200000}`,
+			},
+		},
+		{
+			name: "omitempty and nil pointer",
+			in: hashUser{
+				hashBase: hashBase{ID: 2, Created: created},
+				Name:     "jerry",
+				// 空 []byte 读回后为非nil的空切片
+				Avatar: []byte{},
+			},
+			want: map[string]interface{}{
+				"id":      "2",
+				"created": "2024-01-02T03:04:05Z",
+				"name":    "jerry",
+				"score":   "0",
+				"active":  "false",
+				"ttl":     "0",
+				"avatar":  "",
+				"tags":    "null",
+				"profile": `{"city":"","zip":0}`,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		h, err := StructToHash(&c.in)
+		if err != nil {
+			t.Errorf("%s: StructToHash error: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(h, c.want) {
+			t.Errorf("%s: StructToHash got %v, want %v", c.name, h, c.want)
+			continue
+		}
+
+		data := make(map[string]string, len(h))
+		for k, v := range h {
+			data[k] = v.(string)
+		}
+		var out hashUser
+		err = HashToStruct(data, &out)
+		if err != nil {
+			t.Errorf("%s: HashToStruct error: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, c.in) {
+			t.Errorf("%s: HashToStruct got %+v, want %+v", c.name, out, c.in)
+		}
+	}
+}
+
+func TestHashToStructError(t *testing.T) {
+	var u hashUser
+	if err := HashToStruct(map[string]string{}, u); err == nil {
+		t.Error("HashToStruct should reject a non-pointer")
+	}
+	if err := HashToStruct(map[string]string{"age": "x"}, &u); err == nil {
+		t.Error("HashToStruct should reject an invalid int")
+	}
+	if _, err := StructToHash(1); err == nil {
+		t.Error("StructToHash should reject a non-struct")
+	}
+}
@@ -0,0 +1,345 @@
+// Package redis tool
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	v8 "github.com/go-redis/redis/v8"
+)
+
+// renewLockScript 仅当锁仍由持有者令牌持有时续期，单位毫秒
+var renewLockScript = v8.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// fencedLockScript 获取锁成功时递增栅栏计数并返回，失败返回0
+// KEYS[2] 为栅栏计数key，不设置过期时间，保证单调递增
+var fencedLockScript = v8.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("INCR", KEYS[2])
+end
+return 0
+`)
+
+// scriptNow 脚本开头读取redis服务端的当前毫秒时间 now，过期判断不受各客户端时钟偏差影响
+// redis 5 之前需要先开启命令复制，才能在 TIME 之后执行写命令
+const scriptNow = `
+redis.replicate_commands()
+local server_time = redis.call("TIME")
+local now = tonumber(server_time[1]) * 1000 + math.floor(tonumber(server_time[2]) / 1000)
+`
+
+type fenceCtxKey struct{}
+
+// FenceFromContext 从 WithLockCtx 传入 fn 的 ctx 中读取栅栏令牌
+func FenceFromContext(ctx context.Context) (int64, bool) {
+	fence, ok := ctx.Value(fenceCtxKey{}).(int64)
+	return fence, ok
+}
+
+// Lock 带自动续期（看门狗）的redis锁句柄
+type Lock struct {
+	r         *Redis
+	key       string
+	token     string
+	fence     int64
+	exp       time.Duration
+	opTimeout time.Duration
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	release func(ctx context.Context) error
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// AcquireLock 尝试获取redis锁，获取成功后启动看门狗，每 exp/3 续期一次，直到调用 Release
+// exp <= 0 时锁不过期，不启动看门狗，与 GetLock 一致
+// 续期失败（锁已丢失，或续期出错且下一次续期之前锁可能过期）时取消 Lock.Context()
+func (r *Redis) AcquireLock(key string, lockVal *string, exp int, maxTryTime int, intervalMs int64) (*Lock, error) {
+	token, err := r.TryLock(key, lockVal, exp, maxTryTime, intervalMs)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.newLock(r.ctx, key, token, 0, time.Duration(exp)*time.Second, time.Duration(3)*time.Second), nil
+}
+
+func (r *Redis) newLock(parent context.Context, key, token string, fence int64, exp, opTimeout time.Duration) *Lock {
+	l := new(Lock)
+	l.r = r
+	l.key = key
+	l.token = token
+	l.fence = fence
+	l.exp = exp
+	l.opTimeout = opTimeout
+	if fence > 0 {
+		parent = context.WithValue(parent, fenceCtxKey{}, fence)
+	}
+	l.ctx, l.cancel = context.WithCancel(parent)
+	l.release = func(ctx context.Context) error {
+		return r.freeLock(ctx, key, token)
+	}
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+
+	// 没有过期时间的锁无需续期
+	if exp <= 0 {
+		close(l.done)
+		return l
+	}
+
+	// 获取锁的请求在此之前发出，以当前时间作为续期起点略偏晚，由 exp/3 的续期间隔吸收
+	go l.watchdog(time.Now())
+	return l
+}
+
+// watchdog 每 exp/3 续期一次；续期出错时，若下一次续期之前锁可能过期则立即取消 ctx，
+// 保证 ctx 在锁过期之前被取消，不会出现其他进程已持有锁而临界区仍在执行
+func (l *Lock) watchdog(lastRenew time.Time) {
+	defer close(l.done)
+
+	interval := l.exp / 3
+	if interval <= 0 {
+		interval = l.exp
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		// 续期成功时锁的过期时间从请求发出之前算起，偏保守
+		start := time.Now()
+		ok, err := l.renew()
+		if err != nil {
+			log.Println(err)
+			if time.Since(lastRenew)+interval < l.exp {
+				continue
+			}
+		}
+
+		if !ok {
+			l.cancel()
+			return
+		}
+		lastRenew = start
+	}
+}
+
+func (l *Lock) renew() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opTimeout)
+	defer cancel()
+
+	ret, err := renewLockScript.Run(ctx, l.r.cli, []string{l.key}, l.token, l.exp.Milliseconds()).Int64()
+	if err != nil {
+		return false, err
+	}
+	return ret == 1, nil
+}
+
+// Key 锁的key
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Token 持有者令牌
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Fence 栅栏令牌，仅在 LockOptions.Fencing 为 true 时有效，否则为0
+// 每次获取锁单调递增，下游存储可以据此拒绝旧持有者的写入
+func (l *Lock) Fence() int64 {
+	return l.fence
+}
+
+// Context 锁丢失或释放后被取消，临界区可以据此中止
+func (l *Lock) Context() context.Context {
+	return l.ctx
+}
+
+// Release 停止看门狗并释放锁，重复调用只释放一次
+func (l *Lock) Release() error {
+	err := ErrLockNotOwned
+	l.once.Do(func() {
+		close(l.stop)
+		<-l.done
+		ctx, cancel := context.WithTimeout(context.Background(), l.opTimeout)
+		defer cancel()
+		err = l.release(ctx)
+		l.cancel()
+	})
+	return err
+}
+
+// ErrLockNotObtained 在重试次数或 ctx 截止时间内未能获取锁
+var ErrLockNotObtained = errors.New("redis lock is not obtained")
+
+// LockOptions 锁获取参数
+type LockOptions struct {
+	// Value 持有者令牌，为空时自动生成
+	Value string
+	// Expiration 锁过期时间，看门狗每 Expiration/3 续期一次
+	Expiration time.Duration
+	// MaxRetries 最大重试次数，0 表示不重试，小于0 表示一直重试直到 ctx 结束
+	MaxRetries int
+	// MinBackoff MaxBackoff 重试间隔从 MinBackoff 开始翻倍，最大 MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Jitter 重试间隔随机抖动比例，取值 [0, 1]
+	Jitter float64
+	// OpTimeout 单次redis操作超时时间
+	OpTimeout time.Duration
+	// Fencing 获取锁时同时递增 key+":fence" 计数，通过 Lock.Fence() 返回栅栏令牌
+	// 仅 ObtainLock 和 FairLock 支持；ReentrantLock、RWLock、RedLock、Semaphore 忽略该参数，
+	// GetLock、TryLock、AcquireLock 不提供栅栏令牌
+	Fencing bool
+}
+
+var defaultLockOpts = LockOptions{
+	Expiration: 10 * time.Second,
+	MaxRetries: -1,
+	MinBackoff: 10 * time.Millisecond,
+	MaxBackoff: 500 * time.Millisecond,
+	Jitter:     0.2,
+	OpTimeout:  3 * time.Second,
+}
+
+func DefaultLockOptions() LockOptions {
+	return defaultLockOpts
+}
+
+func (o *LockOptions) backoff(attempt int) time.Duration {
+	d := o.MinBackoff
+	for i := 0; i < attempt && d < o.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > o.MaxBackoff {
+		d = o.MaxBackoff
+	}
+
+	if o.Jitter > 0 {
+		jitter := o.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		d -= time.Duration(float64(d) * jitter * rand.Float64())
+	}
+	return d
+}
+
+// normalize 补全未设置的参数
+func (o *LockOptions) normalize() LockOptions {
+	ret := DefaultLockOptions()
+	if o != nil {
+		ret = *o
+	}
+	if ret.Value == "" {
+		ret.Value = newLockVal()
+	}
+	if ret.Expiration <= 0 {
+		ret.Expiration = defaultLockOpts.Expiration
+	}
+	if ret.OpTimeout <= 0 {
+		ret.OpTimeout = defaultLockOpts.OpTimeout
+	}
+	if ret.MinBackoff <= 0 {
+		ret.MinBackoff = defaultLockOpts.MinBackoff
+	}
+	if ret.MaxBackoff < ret.MinBackoff {
+		ret.MaxBackoff = ret.MinBackoff
+	}
+	return ret
+}
+
+// retry 按退避策略重复执行 try，直到成功、重试次数用完或 ctx 结束
+func (o *LockOptions) retry(ctx context.Context, try func(ctx context.Context) (bool, error)) error {
+	for attempt := 0; ; attempt++ {
+		opCtx, cancel := context.WithTimeout(ctx, o.OpTimeout)
+		ok, err := try(opCtx)
+		cancel()
+		if err == nil && ok {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: %v", ErrLockNotObtained, ctx.Err())
+		}
+
+		if o.MaxRetries >= 0 && attempt >= o.MaxRetries {
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrLockNotObtained, err)
+			}
+			return ErrLockNotObtained
+		}
+
+		timer := time.NewTimer(o.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w: %v", ErrLockNotObtained, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// ObtainLock 获取redis锁，重试按指数退避加随机抖动，等待期间响应 ctx 取消
+// 获取成功后启动看门狗续期，Lock.Context() 派生自 ctx，开启 Fencing 时可通过 FenceFromContext 读取栅栏令牌
+func (r *Redis) ObtainLock(ctx context.Context, key string, opts *LockOptions) (*Lock, error) {
+	if ctx == nil {
+		ctx = r.ctx
+	}
+
+	o := opts.normalize()
+	var fence int64
+	err := o.retry(ctx, func(ctx context.Context) (bool, error) {
+		if !o.Fencing {
+			return r.setNX(ctx, key, o.Value, o.Expiration)
+		}
+
+		ret, err := fencedLockScript.Run(ctx, r.cli, []string{key, r.hashTagKey(key, ":fence")}, o.Value, o.Expiration.Milliseconds()).Int64()
+		if err != nil {
+			return false, err
+		}
+		fence = ret
+		return ret > 0, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.newLock(ctx, key, o.Value, fence, o.Expiration, o.OpTimeout), nil
+}
+
+// WithLockCtx 获取redis锁后执行 fn，返回 fn 的错误；获取失败时返回 ErrLockNotObtained，不会 panic
+// fn 执行期间锁自动续期，锁丢失时 fn 收到的 ctx 被取消
+func (r *Redis) WithLockCtx(ctx context.Context, key string, opts *LockOptions, fn func(ctx context.Context) error) error {
+	l, err := r.ObtainLock(ctx, key, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		e := l.Release()
+		if e != nil {
+			log.Println(e)
+		}
+	}()
+
+	return fn(l.Context())
+}
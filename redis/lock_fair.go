@@ -0,0 +1,212 @@
+// Package redis tool
+package redis
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	v8 "github.com/go-redis/redis/v8"
+)
+
+// 公平锁使用以下key：
+// KEYS[1] 锁本身，值为持有者令牌
+// KEYS[2] 等待队列 zset，score 为入队序号
+// KEYS[3] 等待者超时 zset，score 为等待者失效时间（毫秒，redis服务端时间），等待者每次重试时刷新
+// KEYS[4] 入队序号计数器
+// KEYS[5] 栅栏计数，与 ObtainLock 共用 key+":fence"
+// 释放锁时通过 pub/sub 通知等待者，等待者同时按 MaxBackoff 兜底轮询
+
+// fairLockScript 清理失效等待者，锁空闲且自己位于队首（或队列为空）时获取锁，否则入队并返回0
+// 获取成功时 ARGV[4] 为 "1" 则在同一个脚本中递增栅栏计数并返回，否则返回1
+// 等待者失效时间按redis服务端时间计算，不受各客户端时钟偏差影响
+// ARGV: 令牌、锁过期毫秒、等待者有效期毫秒、是否开启栅栏
+var fairLockScript = v8.NewScript(scriptNow + `
+local expired = redis.call("ZRANGEBYSCORE", KEYS[3], "-inf", now)
+for _, m in ipairs(expired) do
+	redis.call("ZREM", KEYS[2], m)
+	redis.call("ZREM", KEYS[3], m)
+end
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	local first = redis.call("ZRANGE", KEYS[2], 0, 0)
+	if #first == 0 or first[1] == ARGV[1] then
+		redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+		redis.call("ZREM", KEYS[2], ARGV[1])
+		redis.call("ZREM", KEYS[3], ARGV[1])
+		if ARGV[4] == "1" then
+			return redis.call("INCR", KEYS[5])
+		end
+		return 1
+	end
+end
+if redis.call("ZSCORE", KEYS[2], ARGV[1]) == false then
+	redis.call("ZADD", KEYS[2], redis.call("INCR", KEYS[4]), ARGV[1])
+end
+redis.call("ZADD", KEYS[3], now + tonumber(ARGV[3]), ARGV[1])
+return 0
+`)
+
+// fairUnlockScript 持有者释放锁并通知等待者，返回1；非持有者返回0
+// ARGV: 令牌、通知频道
+var fairUnlockScript = v8.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("DEL", KEYS[1])
+	redis.call("PUBLISH", ARGV[2], ARGV[1])
+	return 1
+end
+return 0
+`)
+
+// fairLeaveScript 等待超时的等待者退出队列，如果自己是队首则通知下一个等待者
+// ARGV: 令牌、通知频道
+var fairLeaveScript = v8.NewScript(`
+local first = redis.call("ZRANGE", KEYS[2], 0, 0)
+redis.call("ZREM", KEYS[2], ARGV[1])
+redis.call("ZREM", KEYS[3], ARGV[1])
+if #first > 0 and first[1] == ARGV[1] then
+	redis.call("PUBLISH", ARGV[2], ARGV[1])
+end
+return 1
+`)
+
+// FairLock 公平（FIFO）分布式锁，等待者按入队顺序获取锁
+// 支持 LockOptions.Fencing，栅栏令牌与 ObtainLock 获取同一个key时共用计数
+type FairLock struct {
+	r       *Redis
+	keys    []string
+	channel string
+	value   string
+	opts    LockOptions
+}
+
+// NewFairLock 创建公平锁，opts.Value 为空时每次 Lock 生成新的持有者令牌
+// 等待不受 MaxRetries 限制，直到获取成功或 ctx 结束
+func (r *Redis) NewFairLock(key string, opts *LockOptions) *FairLock {
+	l := new(FairLock)
+	l.r = r
+	l.keys = []string{key, r.hashTagKey(key, ":queue"), r.hashTagKey(key, ":queue_timeout"), r.hashTagKey(key, ":queue_seq"), r.hashTagKey(key, ":fence")}
+	l.channel = key + ":notify"
+	if opts != nil {
+		l.value = opts.Value
+	}
+	l.opts = opts.normalize()
+	return l
+}
+
+// Key 锁的key
+func (l *FairLock) Key() string {
+	return l.keys[0]
+}
+
+// waiterTTL 等待者失效时间，等待者异常退出后其队列项在此时间后被清理
+func (l *FairLock) waiterTTL() time.Duration {
+	ttl := 3 * l.opts.MaxBackoff
+	if ttl < l.opts.OpTimeout {
+		ttl = l.opts.OpTimeout
+	}
+	return ttl
+}
+
+// tryLock 获取成功返回大于0的值，开启 Fencing 时为栅栏令牌
+func (l *FairLock) tryLock(ctx context.Context, token string) (int64, error) {
+	opCtx, cancel := context.WithTimeout(ctx, l.opts.OpTimeout)
+	defer cancel()
+
+	fencing := "0"
+	if l.opts.Fencing {
+		fencing = "1"
+	}
+	return fairLockScript.Run(opCtx, l.r.cli, l.keys, token, l.opts.Expiration.Milliseconds(),
+		l.waiterTTL().Milliseconds(), fencing).Int64()
+}
+
+func (l *FairLock) leave(token string) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.OpTimeout)
+	defer cancel()
+
+	err := fairLeaveScript.Run(ctx, l.r.cli, l.keys, token, l.channel).Err()
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// Lock 排队获取锁，锁释放时按入队顺序唤醒下一个等待者；ctx 结束时退出队列并返回 ErrLockNotObtained
+// 获取成功后启动看门狗续期，释放时通知下一个等待者；开启 Fencing 时通过 Lock.Fence() 或 FenceFromContext 读取栅栏令牌
+func (l *FairLock) Lock(ctx context.Context) (*Lock, error) {
+	if ctx == nil {
+		ctx = l.r.ctx
+	}
+
+	token := l.value
+	if token == "" {
+		token = newLockVal()
+	}
+
+	sub := l.r.cli.Subscribe(ctx, l.channel)
+	defer func() {
+		e := sub.Close()
+		if e != nil {
+			log.Println(e)
+		}
+	}()
+	_, err := sub.Receive(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLockNotObtained, err)
+	}
+	notify := sub.Channel()
+
+	var fence int64
+	for {
+		ret, err := l.tryLock(ctx, token)
+		if err == nil && ret > 0 {
+			if l.opts.Fencing {
+				fence = ret
+			}
+			break
+		}
+		if err != nil {
+			log.Println(err)
+		}
+
+		timer := time.NewTimer(l.opts.MaxBackoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			l.leave(token)
+			return nil, fmt.Errorf("%w: %v", ErrLockNotObtained, ctx.Err())
+		case <-notify:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+
+	lock := l.r.newLock(ctx, l.Key(), token, fence, l.opts.Expiration, l.opts.OpTimeout)
+	lock.release = func(ctx context.Context) error {
+		ret, err := fairUnlockScript.Run(ctx, l.r.cli, l.keys[:1], token, l.channel).Int64()
+		if err != nil {
+			return err
+		}
+		if ret == 0 {
+			return ErrLockNotOwned
+		}
+		return nil
+	}
+	return lock, nil
+}
+
+// WithLock 排队获取锁后执行 fn，返回 fn 的错误
+func (l *FairLock) WithLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	lock, err := l.Lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		e := lock.Release()
+		if e != nil {
+			log.Println(e)
+		}
+	}()
+
+	return fn(lock.Context())
+}
@@ -0,0 +1,192 @@
+// Package redis tool
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// redLockDriftFactor 时钟漂移系数，参考 Redlock 算法
+const redLockDriftFactor = 0.01
+
+// RedLock 多节点（Redlock 算法）分布式锁管理器
+// 在多数（n/2+1）独立redis节点上获取成功才算加锁成功，允许少数节点不可用
+// 不支持 LockOptions.Fencing，各节点的计数相互独立，无法得到单调递增的栅栏令牌
+type RedLock struct {
+	clients []*Redis
+	quorum  int
+	opts    LockOptions
+	value   string
+}
+
+// RedLockLease 多节点锁的持有凭证
+type RedLockLease struct {
+	m     *RedLock
+	key   string
+	token string
+	until time.Time
+}
+
+// NewRedLock 创建多节点锁管理器，clients 应为相互独立的redis节点
+// opts.Value 为空时每次 Lock 生成新的持有者令牌
+func NewRedLock(clients []*Redis, opts *LockOptions) *RedLock {
+	if len(clients) == 0 {
+		panic("redlock clients must not be empty")
+	}
+
+	m := new(RedLock)
+	m.clients = clients
+	m.quorum = len(clients)/2 + 1
+	if opts != nil {
+		m.value = opts.Value
+	}
+	m.opts = opts.normalize()
+	return m
+}
+
+// drift 时钟漂移补偿
+func (m *RedLock) drift() time.Duration {
+	return time.Duration(float64(m.opts.Expiration)*redLockDriftFactor) + 2*time.Millisecond
+}
+
+// each 在所有节点上并发执行 fn，返回成功的节点数
+func (m *RedLock) each(ctx context.Context, fn func(ctx context.Context, r *Redis) (bool, error)) (int, error) {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		count int
+		first error
+	)
+	for _, cli := range m.clients {
+		wg.Add(1)
+		go func(r *Redis) {
+			defer wg.Done()
+
+			opCtx, cancel := context.WithTimeout(ctx, m.opts.OpTimeout)
+			defer cancel()
+			ok, err := fn(opCtx, r)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && first == nil {
+				first = err
+			}
+			if ok {
+				count++
+			}
+		}(cli)
+	}
+	wg.Wait()
+
+	return count, first
+}
+
+func (m *RedLock) release(key, token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.opts.OpTimeout)
+	defer cancel()
+
+	_, err := m.each(ctx, func(ctx context.Context, r *Redis) (bool, error) {
+		err := r.freeLock(ctx, key, token)
+		if errors.Is(err, ErrLockNotOwned) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	return err
+}
+
+// Lock 在多数节点上获取锁，有效期为 Expiration 减去获取耗时和时钟漂移
+// 未达到多数或有效期耗尽时在所有节点上释放，并按 LockOptions 的退避策略重试
+func (m *RedLock) Lock(ctx context.Context, key string) (*RedLockLease, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	token := m.value
+	if token == "" {
+		token = newLockVal()
+	}
+
+	var until time.Time
+	err := m.opts.retry(ctx, func(ctx context.Context) (bool, error) {
+		start := time.Now()
+		count, err := m.each(ctx, func(ctx context.Context, r *Redis) (bool, error) {
+			return r.setNX(ctx, key, token, m.opts.Expiration)
+		})
+
+		validity := m.opts.Expiration - time.Since(start) - m.drift()
+		if count >= m.quorum && validity > 0 {
+			until = start.Add(validity)
+			return true, nil
+		}
+
+		e := m.release(key, token)
+		if e != nil && err == nil {
+			err = e
+		}
+		return false, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lease := new(RedLockLease)
+	lease.m = m
+	lease.key = key
+	lease.token = token
+	lease.until = until
+	return lease, nil
+}
+
+// Key 锁的key
+func (l *RedLockLease) Key() string {
+	return l.key
+}
+
+// Token 持有者令牌
+func (l *RedLockLease) Token() string {
+	return l.token
+}
+
+// Until 锁的有效截止时间，超过后不应再认为持有锁
+func (l *RedLockLease) Until() time.Time {
+	return l.until
+}
+
+// Valid 当前是否仍在有效期内
+func (l *RedLockLease) Valid() bool {
+	return time.Now().Before(l.until)
+}
+
+// Extend 在多数节点上续期，成功后更新有效截止时间，失败返回 ErrLockNotOwned
+func (l *RedLockLease) Extend(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	start := time.Now()
+	count, err := l.m.each(ctx, func(ctx context.Context, r *Redis) (bool, error) {
+		ret, err := renewLockScript.Run(ctx, r.cli, []string{l.key}, l.token, l.m.opts.Expiration.Milliseconds()).Int64()
+		return ret == 1, err
+	})
+
+	validity := l.m.opts.Expiration - time.Since(start) - l.m.drift()
+	if count >= l.m.quorum && validity > 0 {
+		l.until = start.Add(validity)
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrLockNotOwned, err)
+	}
+	return ErrLockNotOwned
+}
+
+// Release 在所有节点上释放锁
+func (l *RedLockLease) Release() error {
+	l.until = time.Time{}
+	return l.m.release(l.key, l.token)
+}
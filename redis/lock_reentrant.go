@@ -0,0 +1,165 @@
+// Package redis tool
+package redis
+
+import (
+	"context"
+	"log"
+
+	v8 "github.com/go-redis/redis/v8"
+)
+
+// acquireReentrantScript 锁不存在或由同一持有者持有时计数加1并续期，返回持有次数，否则返回0
+var acquireReentrantScript = v8.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 or redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+	local n = redis.call("HINCRBY", KEYS[1], ARGV[1], 1)
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return n
+end
+return 0
+`)
+
+// releaseReentrantScript 持有计数减1，减到0时删除锁，返回剩余次数；非持有者返回-1
+var releaseReentrantScript = v8.NewScript(`
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 then
+	return -1
+end
+local n = redis.call("HINCRBY", KEYS[1], ARGV[1], -1)
+if n > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return n
+end
+redis.call("DEL", KEYS[1])
+return 0
+`)
+
+// refreshReentrantScript 仅当持有者仍持有锁时续期
+var refreshReentrantScript = v8.NewScript(`
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// ReentrantLock 可重入redis锁，基于hash存储 持有者令牌 -> 持有次数
+// 同一持有者（相同 LockOptions.Value）可以嵌套获取，持有次数减到0时释放
+// 不支持 LockOptions.Fencing
+type ReentrantLock struct {
+	r    *Redis
+	key  string
+	opts LockOptions
+}
+
+// NewReentrantLock 创建可重入锁，opts.Value 为持有者令牌，为空时自动生成
+// 需要在调用链中重入时，传递同一个 ReentrantLock 或使用相同的 Value
+func (r *Redis) NewReentrantLock(key string, opts *LockOptions) *ReentrantLock {
+	l := new(ReentrantLock)
+	l.r = r
+	l.key = key
+	l.opts = opts.normalize()
+	return l
+}
+
+// Key 锁的key
+func (l *ReentrantLock) Key() string {
+	return l.key
+}
+
+// Token 持有者令牌
+func (l *ReentrantLock) Token() string {
+	return l.opts.Value
+}
+
+func (l *ReentrantLock) tryLock(ctx context.Context) (int64, error) {
+	return acquireReentrantScript.Run(ctx, l.r.cli, []string{l.key}, l.opts.Value, l.opts.Expiration.Milliseconds()).Int64()
+}
+
+// TryLock 尝试获取一次锁，成功返回当前持有次数，被其他持有者占用返回0
+func (l *ReentrantLock) TryLock(ctx context.Context) (int64, error) {
+	if ctx == nil {
+		ctx = l.r.ctx
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, l.opts.OpTimeout)
+	defer cancel()
+	return l.tryLock(opCtx)
+}
+
+// Lock 获取锁，按 LockOptions 的退避策略重试，成功返回当前持有次数
+func (l *ReentrantLock) Lock(ctx context.Context) (int64, error) {
+	if ctx == nil {
+		ctx = l.r.ctx
+	}
+
+	var count int64
+	err := l.opts.retry(ctx, func(ctx context.Context) (bool, error) {
+		n, err := l.tryLock(ctx)
+		if err != nil {
+			return false, err
+		}
+		count = n
+		return n > 0, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Unlock 持有次数减1，返回剩余次数，为0时锁已释放；非持有者返回 ErrLockNotOwned
+func (l *ReentrantLock) Unlock(ctx context.Context) (int64, error) {
+	if ctx == nil {
+		ctx = l.r.ctx
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, l.opts.OpTimeout)
+	defer cancel()
+
+	n, err := releaseReentrantScript.Run(opCtx, l.r.cli, []string{l.key}, l.opts.Value, l.opts.Expiration.Milliseconds()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, ErrLockNotOwned
+	}
+	return n, nil
+}
+
+// Refresh 续期锁，非持有者返回 ErrLockNotOwned
+func (l *ReentrantLock) Refresh(ctx context.Context) error {
+	if ctx == nil {
+		ctx = l.r.ctx
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, l.opts.OpTimeout)
+	defer cancel()
+
+	n, err := refreshReentrantScript.Run(opCtx, l.r.cli, []string{l.key}, l.opts.Value, l.opts.Expiration.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockNotOwned
+	}
+	return nil
+}
+
+// WithLock 获取锁后执行 fn，执行完成后持有次数减1，返回 fn 的错误
+func (l *ReentrantLock) WithLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx == nil {
+		ctx = l.r.ctx
+	}
+
+	_, err := l.Lock(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_, e := l.Unlock(context.Background())
+		if e != nil {
+			log.Println(e)
+		}
+	}()
+
+	return fn(ctx)
+}
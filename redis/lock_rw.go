@@ -0,0 +1,266 @@
+// Package redis tool
+package redis
+
+import (
+	"context"
+	"log"
+	"time"
+
+	v8 "github.com/go-redis/redis/v8"
+)
+
+// 读写锁存储在hash中：写锁字段 "w" -> 写持有者令牌，读锁字段 "r:<令牌>" -> 读持有次数
+// KEYS[2] 为等待中的写者标记，存在时新的读者不能获取读锁（写优先，防止写者饥饿）
+// KEYS[3] 为读者过期时间的zset：读者令牌 -> 过期毫秒时间戳，每个读者单独过期，
+// 崩溃的读者不会因为其他读者续期而一直占用读锁
+// 所有脚本的 ARGV[1] 为持有者令牌，过期时间按redis服务端时间计算，与 GetLock 依赖服务端TTL一致
+
+// rwPurgeReaders 删除已过期的读者，hash 中最后一个字段删除后 hash 随之删除
+const rwPurgeReaders = scriptNow + `
+local function extend(key, ttl)
+	if redis.call("PTTL", key) < ttl then
+		redis.call("PEXPIRE", key, ttl)
+	end
+end
+local expired = redis.call("ZRANGEBYSCORE", KEYS[3], "-inf", now)
+if #expired > 0 then
+	for _, token in ipairs(expired) do
+		redis.call("HDEL", KEYS[1], "r:" .. token)
+	end
+	redis.call("ZREMRANGEBYSCORE", KEYS[3], "-inf", now)
+end
+`
+
+// rLockScript 无写锁且无等待写者（或已持有读锁）时获取读锁，返回1，否则返回0
+var rLockScript = v8.NewScript(rwPurgeReaders + `
+if redis.call("HEXISTS", KEYS[1], "w") == 1 then
+	return 0
+end
+local field = "r:" .. ARGV[1]
+if redis.call("EXISTS", KEYS[2]) == 1 and redis.call("HEXISTS", KEYS[1], field) == 0 then
+	return 0
+end
+local ttl = tonumber(ARGV[2])
+redis.call("HINCRBY", KEYS[1], field, 1)
+redis.call("ZADD", KEYS[3], now + ttl, ARGV[1])
+extend(KEYS[1], ttl)
+extend(KEYS[3], ttl)
+return 1
+`)
+
+// rUnlockScript 读持有次数减1，减到0时删除该读者，返回1；非持有者（包括已过期的读者）返回0
+var rUnlockScript = v8.NewScript(rwPurgeReaders + `
+local field = "r:" .. ARGV[1]
+if redis.call("HEXISTS", KEYS[1], field) == 0 then
+	return 0
+end
+if redis.call("HINCRBY", KEYS[1], field, -1) <= 0 then
+	redis.call("HDEL", KEYS[1], field)
+	redis.call("ZREM", KEYS[3], ARGV[1])
+end
+return 1
+`)
+
+// wLockScript 无任何持有者时获取写锁并清除自己的等待标记，返回1；否则设置等待标记，返回0
+var wLockScript = v8.NewScript(rwPurgeReaders + `
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	redis.call("HSET", KEYS[1], "w", ARGV[1])
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	if redis.call("GET", KEYS[2]) == ARGV[1] then
+		redis.call("DEL", KEYS[2])
+	end
+	return 1
+end
+if redis.call("HGET", KEYS[1], "w") == ARGV[1] then
+	return 1
+end
+redis.call("SET", KEYS[2], ARGV[1], "PX", ARGV[3])
+return 0
+`)
+
+// wUnlockScript 写持有者释放写锁，返回1；非持有者返回0
+var wUnlockScript = v8.NewScript(`
+if redis.call("HGET", KEYS[1], "w") == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// rwRefreshScript 持有者（读或写）续期，读者只延长自己的过期时间，返回1；非持有者返回0
+var rwRefreshScript = v8.NewScript(rwPurgeReaders + `
+local ttl = tonumber(ARGV[2])
+if redis.call("HGET", KEYS[1], "w") == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ttl)
+end
+if redis.call("HEXISTS", KEYS[1], "r:" .. ARGV[1]) == 1 then
+	redis.call("ZADD", KEYS[3], now + ttl, ARGV[1])
+	extend(KEYS[1], ttl)
+	extend(KEYS[3], ttl)
+	return 1
+end
+return 0
+`)
+
+// RWLock 分布式读写锁，多个读者共享，写者独占，写优先
+// 过期语义与 GetLock 相同：锁在 LockOptions.Expiration 后自动过期，每个读者单独计算过期时间
+// 不支持 LockOptions.Fencing
+type RWLock struct {
+	r          *Redis
+	key        string
+	waitKey    string
+	readersKey string
+	opts       LockOptions
+}
+
+// NewRWLock 创建读写锁，opts.Value 为持有者令牌，为空时自动生成
+func (r *Redis) NewRWLock(key string, opts *LockOptions) *RWLock {
+	l := new(RWLock)
+	l.r = r
+	l.key = key
+	l.waitKey = r.hashTagKey(key, ":writer_wait")
+	l.readersKey = r.hashTagKey(key, ":readers")
+	l.opts = opts.normalize()
+	return l
+}
+
+// Key 锁的key
+func (l *RWLock) Key() string {
+	return l.key
+}
+
+// Token 持有者令牌
+func (l *RWLock) Token() string {
+	return l.opts.Value
+}
+
+func (l *RWLock) keys() []string {
+	return []string{l.key, l.waitKey, l.readersKey}
+}
+
+// writerWait 写者等待标记的有效期，写者停止重试后标记自动失效
+func (l *RWLock) writerWait() time.Duration {
+	wait := 3 * l.opts.MaxBackoff
+	if wait < l.opts.OpTimeout {
+		wait = l.opts.OpTimeout
+	}
+	return wait
+}
+
+// run 执行脚本，参数依次为持有者令牌、args
+func (l *RWLock) run(ctx context.Context, script *v8.Script, args ...interface{}) (bool, error) {
+	if ctx == nil {
+		ctx = l.r.ctx
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, l.opts.OpTimeout)
+	defer cancel()
+
+	argv := append([]interface{}{l.opts.Value}, args...)
+	ret, err := script.Run(opCtx, l.r.cli, l.keys(), argv...).Int64()
+	if err != nil {
+		return false, err
+	}
+	return ret == 1, nil
+}
+
+// TryRLock 尝试获取一次读锁
+func (l *RWLock) TryRLock(ctx context.Context) (bool, error) {
+	return l.run(ctx, rLockScript, l.opts.Expiration.Milliseconds())
+}
+
+// TryLock 尝试获取一次写锁，失败时登记为等待写者
+func (l *RWLock) TryLock(ctx context.Context) (bool, error) {
+	return l.run(ctx, wLockScript, l.opts.Expiration.Milliseconds(), l.writerWait().Milliseconds())
+}
+
+// RLock 获取读锁，按 LockOptions 的退避策略重试
+func (l *RWLock) RLock(ctx context.Context) error {
+	if ctx == nil {
+		ctx = l.r.ctx
+	}
+	return l.opts.retry(ctx, l.TryRLock)
+}
+
+// Lock 获取写锁，按 LockOptions 的退避策略重试，等待期间阻止新的读者
+func (l *RWLock) Lock(ctx context.Context) error {
+	if ctx == nil {
+		ctx = l.r.ctx
+	}
+	return l.opts.retry(ctx, l.TryLock)
+}
+
+// RUnlock 释放一次读锁，非持有者返回 ErrLockNotOwned
+func (l *RWLock) RUnlock(ctx context.Context) error {
+	ok, err := l.run(ctx, rUnlockScript)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLockNotOwned
+	}
+	return nil
+}
+
+// Unlock 释放写锁，非持有者返回 ErrLockNotOwned
+func (l *RWLock) Unlock(ctx context.Context) error {
+	ok, err := l.run(ctx, wUnlockScript)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLockNotOwned
+	}
+	return nil
+}
+
+// Refresh 续期当前持有的读锁或写锁，非持有者返回 ErrLockNotOwned
+func (l *RWLock) Refresh(ctx context.Context) error {
+	ok, err := l.run(ctx, rwRefreshScript, l.opts.Expiration.Milliseconds())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLockNotOwned
+	}
+	return nil
+}
+
+// WithRLock 获取读锁后执行 fn，返回 fn 的错误
+func (l *RWLock) WithRLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx == nil {
+		ctx = l.r.ctx
+	}
+
+	err := l.RLock(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		e := l.RUnlock(context.Background())
+		if e != nil {
+			log.Println(e)
+		}
+	}()
+
+	return fn(ctx)
+}
+
+// WithLock 获取写锁后执行 fn，返回 fn 的错误
+func (l *RWLock) WithLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx == nil {
+		ctx = l.r.ctx
+	}
+
+	err := l.Lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		e := l.Unlock(context.Background())
+		if e != nil {
+			log.Println(e)
+		}
+	}()
+
+	return fn(ctx)
+}
@@ -0,0 +1,70 @@
+// Package redis tool
+package redis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockOptionsBackoff(t *testing.T) {
+	o := &LockOptions{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 100 * time.Millisecond,
+	}
+
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 10 * time.Millisecond},
+		{1, 20 * time.Millisecond},
+		{2, 40 * time.Millisecond},
+		{3, 80 * time.Millisecond},
+		{4, 100 * time.Millisecond},
+		{1000, 100 * time.Millisecond},
+	}
+	for _, c := range cases {
+		if got := o.backoff(c.attempt); got != c.want {
+			t.Errorf("backoff(%d) got %v, want %v", c.attempt, got, c.want)
+		}
+	}
+}
+
+func TestLockOptionsBackoffJitter(t *testing.T) {
+	cases := []struct {
+		jitter float64
+		min    time.Duration
+	}{
+		{0.5, 40 * time.Millisecond},
+		// 大于1按1处理
+		{2, 0},
+	}
+
+	for _, c := range cases {
+		o := &LockOptions{
+			MinBackoff: 10 * time.Millisecond,
+			MaxBackoff: 80 * time.Millisecond,
+			Jitter:     c.jitter,
+		}
+		for i := 0; i < 1000; i++ {
+			got := o.backoff(10)
+			if got < c.min || got > o.MaxBackoff {
+				t.Errorf("jitter %v backoff got %v, want in [%v, %v]", c.jitter, got, c.min, o.MaxBackoff)
+				break
+			}
+		}
+	}
+}
+
+func TestLockOptionsNormalize(t *testing.T) {
+	o := (&LockOptions{
+		MinBackoff: 50 * time.Millisecond,
+		MaxBackoff: 10 * time.Millisecond,
+	}).normalize()
+	if o.MaxBackoff != o.MinBackoff {
+		t.Errorf("MaxBackoff got %v, want %v", o.MaxBackoff, o.MinBackoff)
+	}
+	if o.Value == "" || o.Expiration <= 0 || o.OpTimeout <= 0 {
+		t.Errorf("normalize should fill defaults, got %+v", o)
+	}
+}
@@ -10,8 +10,120 @@ import (
 	v8 "github.com/go-redis/redis/v8"
 )
 
+// Mode 部署模式
+type Mode int
+
+const (
+	// ModeSingle 单机，连接 Options.Addr
+	ModeSingle Mode = iota
+	// ModeSentinel 哨兵，Addrs 为哨兵地址，MasterName 为主节点名
+	ModeSentinel
+	// ModeCluster 集群，Addrs 为集群种子节点
+	ModeCluster
+)
+
+// Options 连接参数，v8.Options 中的认证、连接池、超时、重试参数对所有部署模式生效
+// 哨兵和集群模式忽略 Addr，使用 Addrs；集群模式忽略 DB
+// 新增部署模式字段后不能再使用按位置初始化的 Options{v8opts}，需要写作 Options{Options: v8opts}
 type Options struct {
 	v8.Options
+
+	Mode  Mode
+	Addrs []string
+
+	// 哨兵模式
+	MasterName       string
+	SentinelUsername string
+	SentinelPassword string
+
+	// 集群模式
+	MaxRedirects   int
+	ReadOnly       bool
+	RouteByLatency bool
+	RouteRandomly  bool
+}
+
+// newClient 按部署模式创建客户端
+func (opt *Options) newClient() v8.UniversalClient {
+	switch opt.Mode {
+	case ModeSentinel:
+		return v8.NewFailoverClient(opt.failoverOptions())
+	case ModeCluster:
+		return v8.NewClusterClient(opt.clusterOptions())
+	default:
+		return v8.NewClient(&opt.Options)
+	}
+}
+
+func (opt *Options) failoverOptions() *v8.FailoverOptions {
+	o := &opt.Options
+	return &v8.FailoverOptions{
+		MasterName:       opt.MasterName,
+		SentinelAddrs:    opt.Addrs,
+		SentinelUsername: opt.SentinelUsername,
+		SentinelPassword: opt.SentinelPassword,
+
+		Dialer:    o.Dialer,
+		OnConnect: o.OnConnect,
+
+		Username: o.Username,
+		Password: o.Password,
+		DB:       o.DB,
+
+		MaxRetries:      o.MaxRetries,
+		MinRetryBackoff: o.MinRetryBackoff,
+		MaxRetryBackoff: o.MaxRetryBackoff,
+
+		DialTimeout:  o.DialTimeout,
+		ReadTimeout:  o.ReadTimeout,
+		WriteTimeout: o.WriteTimeout,
+
+		PoolFIFO:           o.PoolFIFO,
+		PoolSize:           o.PoolSize,
+		MinIdleConns:       o.MinIdleConns,
+		MaxConnAge:         o.MaxConnAge,
+		PoolTimeout:        o.PoolTimeout,
+		IdleTimeout:        o.IdleTimeout,
+		IdleCheckFrequency: o.IdleCheckFrequency,
+
+		TLSConfig: o.TLSConfig,
+	}
+}
+
+func (opt *Options) clusterOptions() *v8.ClusterOptions {
+	o := &opt.Options
+	return &v8.ClusterOptions{
+		Addrs: opt.Addrs,
+
+		MaxRedirects:   opt.MaxRedirects,
+		ReadOnly:       opt.ReadOnly,
+		RouteByLatency: opt.RouteByLatency,
+		RouteRandomly:  opt.RouteRandomly,
+
+		Dialer:    o.Dialer,
+		OnConnect: o.OnConnect,
+
+		Username: o.Username,
+		Password: o.Password,
+
+		MaxRetries:      o.MaxRetries,
+		MinRetryBackoff: o.MinRetryBackoff,
+		MaxRetryBackoff: o.MaxRetryBackoff,
+
+		DialTimeout:  o.DialTimeout,
+		ReadTimeout:  o.ReadTimeout,
+		WriteTimeout: o.WriteTimeout,
+
+		PoolFIFO:           o.PoolFIFO,
+		PoolSize:           o.PoolSize,
+		MinIdleConns:       o.MinIdleConns,
+		MaxConnAge:         o.MaxConnAge,
+		PoolTimeout:        o.PoolTimeout,
+		IdleTimeout:        o.IdleTimeout,
+		IdleCheckFrequency: o.IdleCheckFrequency,
+
+		TLSConfig: o.TLSConfig,
+	}
 }
 
 func NewOptions() *Options {
@@ -20,7 +132,7 @@ func NewOptions() *Options {
 }
 
 var defaultOpts = Options{
-	v8.Options{
+	Options: v8.Options{
 		Network:  "tcp",
 		Addr:     "",
 		Username: "",
@@ -0,0 +1,305 @@
+// Package redis tool
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	v8 "github.com/go-redis/redis/v8"
+)
+
+// ErrPipelineNotExecuted 管道尚未执行时读取结果
+var ErrPipelineNotExecuted = errors.New("redis pipeline is not executed")
+
+// Future 管道中命令的结果，Exec 之后可读取
+type Future[T any] struct {
+	p      *Pipeline
+	result func() (T, error)
+}
+
+// Result 命令结果，管道未执行时返回 ErrPipelineNotExecuted
+func (f *Future[T]) Result() (T, error) {
+	if !f.p.executed {
+		var zero T
+		return zero, ErrPipelineNotExecuted
+	}
+	return f.result()
+}
+
+// Val 命令结果，忽略错误
+func (f *Future[T]) Val() T {
+	ret, _ := f.Result()
+	return ret
+}
+
+type resultCmd[T any] interface {
+	Result() (T, error)
+}
+
+func newFuture[T any](p *Pipeline, cmd resultCmd[T]) *Future[T] {
+	return &Future[T]{
+		p:      p,
+		result: cmd.Result,
+	}
+}
+
+// newNilFuture key 不存在（redis.Nil）时返回零值和nil，与 Redis.Get 一致
+func newNilFuture[T any](p *Pipeline, cmd resultCmd[T]) *Future[T] {
+	return &Future[T]{
+		p: p,
+		result: func() (T, error) {
+			ret, err := cmd.Result()
+			if err == v8.Nil {
+				return ret, nil
+			}
+			return ret, err
+		},
+	}
+}
+
+// Pipeline 管道，批量发送命令减少往返；TxPipeline 创建的管道在 MULTI/EXEC 中执行
+type Pipeline struct {
+	pipe     v8.Pipeliner
+	ctx      context.Context
+	executed bool
+}
+
+// Pipeline 创建普通管道
+func (r *Redis) Pipeline() *Pipeline {
+	return &Pipeline{
+		pipe: r.cli.Pipeline(),
+		ctx:  r.ctx,
+	}
+}
+
+// TxPipeline 创建事务管道，命令在 MULTI/EXEC 中原子执行
+func (r *Redis) TxPipeline() *Pipeline {
+	return &Pipeline{
+		pipe: r.cli.TxPipeline(),
+		ctx:  r.ctx,
+	}
+}
+
+// Exec 执行全部排队的命令，各命令的结果通过 Future 读取
+// key 不存在（redis.Nil）不视为错误，其他错误返回第一个失败命令的错误
+func (p *Pipeline) Exec(ctx context.Context) error {
+	ctxObj := p.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+
+	cmds, err := p.pipe.Exec(ctxObj)
+	p.executed = true
+	return firstErr(cmds, err)
+}
+
+// firstErr 第一个不是 redis.Nil 的命令错误
+// go-redis 的 Exec 只返回第一个失败命令的错误，它可能是 redis.Nil，需要继续检查之后的命令
+func firstErr(cmds []v8.Cmder, err error) error {
+	if err != v8.Nil {
+		return err
+	}
+	for _, cmd := range cmds {
+		if e := cmd.Err(); e != nil && e != v8.Nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// Discard 丢弃全部排队的命令
+func (p *Pipeline) Discard() error {
+	return p.pipe.Discard()
+}
+
+func (p *Pipeline) Set(key, val string) *Future[string] {
+	return newFuture[string](p, p.pipe.Set(p.ctx, key, val, 0))
+}
+
+func (p *Pipeline) SetEx(key, val string, expSecond int) *Future[string] {
+	return newFuture[string](p, p.pipe.SetEX(p.ctx, key, val, time.Duration(expSecond)*time.Second))
+}
+
+func (p *Pipeline) SetNxSec(key, val string, expSecond int) *Future[bool] {
+	return newFuture[bool](p, p.pipe.SetNX(p.ctx, key, val, time.Duration(expSecond)*time.Second))
+}
+
+// Get key 不存在时结果为空字符串
+func (p *Pipeline) Get(key string) *Future[string] {
+	return newNilFuture[string](p, p.pipe.Get(p.ctx, key))
+}
+
+func (p *Pipeline) Del(key ...string) *Future[int64] {
+	return newFuture[int64](p, p.pipe.Del(p.ctx, key...))
+}
+
+func (p *Pipeline) Expire(key string, expSecond int) *Future[bool] {
+	return newFuture[bool](p, p.pipe.Expire(p.ctx, key, time.Duration(expSecond)*time.Second))
+}
+
+func (p *Pipeline) Incr(key string) *Future[int64] {
+	return newFuture[int64](p, p.pipe.Incr(p.ctx, key))
+}
+
+func (p *Pipeline) IncrBy(key string, value int64) *Future[int64] {
+	return newFuture[int64](p, p.pipe.IncrBy(p.ctx, key, value))
+}
+
+func (p *Pipeline) SAdd(key string, members ...interface{}) *Future[int64] {
+	return newFuture[int64](p, p.pipe.SAdd(p.ctx, key, members...))
+}
+
+func (p *Pipeline) SRem(key string, members ...interface{}) *Future[int64] {
+	return newFuture[int64](p, p.pipe.SRem(p.ctx, key, members...))
+}
+
+func (p *Pipeline) ZAdd(key string, member interface{}, score float64) *Future[int64] {
+	return newFuture[int64](p, p.pipe.ZAdd(p.ctx, key, &v8.Z{
+		Member: member,
+		Score:  score,
+	}))
+}
+
+func (p *Pipeline) ZAddList(key string, memList ...ZMember) *Future[int64] {
+	zList := make([]*v8.Z, len(memList))
+	for i, mem := range memList {
+		zList[i] = &v8.Z{
+			Member: mem.Member,
+			Score:  mem.Score,
+		}
+	}
+	return newFuture[int64](p, p.pipe.ZAdd(p.ctx, key, zList...))
+}
+
+func (p *Pipeline) ZRem(key string, memberList ...interface{}) *Future[int64] {
+	return newFuture[int64](p, p.pipe.ZRem(p.ctx, key, memberList...))
+}
+
+func (p *Pipeline) ZIncrBy(key string, increment float64, member string) *Future[float64] {
+	return newFuture[float64](p, p.pipe.ZIncrBy(p.ctx, key, increment, member))
+}
+
+func (p *Pipeline) HSet(key string, values ...interface{}) *Future[int64] {
+	return newFuture[int64](p, p.pipe.HSet(p.ctx, key, values...))
+}
+
+// HGet field 不存在时结果为空字符串
+func (p *Pipeline) HGet(key, field string) *Future[string] {
+	return newNilFuture[string](p, p.pipe.HGet(p.ctx, key, field))
+}
+
+func (p *Pipeline) HGetAll(key string) *Future[map[string]string] {
+	return newFuture[map[string]string](p, p.pipe.HGetAll(p.ctx, key))
+}
+
+func (p *Pipeline) HDel(key string, fields ...string) *Future[int64] {
+	return newFuture[int64](p, p.pipe.HDel(p.ctx, key, fields...))
+}
+
+func (p *Pipeline) HIncrBy(key, field string, incr int64) *Future[int64] {
+	return newFuture[int64](p, p.pipe.HIncrBy(p.ctx, key, field, incr))
+}
+
+func (p *Pipeline) LPush(key string, values ...interface{}) *Future[int64] {
+	return newFuture[int64](p, p.pipe.LPush(p.ctx, key, values...))
+}
+
+func (p *Pipeline) RPush(key string, values ...interface{}) *Future[int64] {
+	return newFuture[int64](p, p.pipe.RPush(p.ctx, key, values...))
+}
+
+func (p *Pipeline) Publish(channel string, message interface{}) *Future[int64] {
+	return newFuture[int64](p, p.pipe.Publish(p.ctx, channel, message))
+}
+
+// Tx WATCH 乐观事务，读取被监视的key，并通过 Exec 提交写操作
+type Tx struct {
+	tx  *v8.Tx
+	ctx context.Context
+}
+
+// Raw 原始的 v8.Tx，用于执行未封装的读命令
+func (t *Tx) Raw() *v8.Tx {
+	return t.tx
+}
+
+// Get key 不存在时返回空字符串
+func (t *Tx) Get(key string) (string, error) {
+	ret, err := t.tx.Get(t.ctx, key).Result()
+	if err == v8.Nil {
+		return "", nil
+	}
+	return ret, err
+}
+
+func (t *Tx) Exists(key ...string) (int64, error) {
+	return t.tx.Exists(t.ctx, key...).Result()
+}
+
+// HGet field 不存在时返回空字符串
+func (t *Tx) HGet(key, field string) (string, error) {
+	ret, err := t.tx.HGet(t.ctx, key, field).Result()
+	if err == v8.Nil {
+		return "", nil
+	}
+	return ret, err
+}
+
+func (t *Tx) HGetAll(key string) (map[string]string, error) {
+	return t.tx.HGetAll(t.ctx, key).Result()
+}
+
+func (t *Tx) SMembers(key string) ([]string, error) {
+	return t.tx.SMembers(t.ctx, key).Result()
+}
+
+// Exec 在 MULTI/EXEC 中执行 fn 排队的命令，被监视的key发生变化时返回 v8.TxFailedErr
+// fn 返回错误时不执行任何命令，Future 返回 ErrPipelineNotExecuted
+func (t *Tx) Exec(fn func(p *Pipeline) error) error {
+	var p *Pipeline
+	queued := false
+	cmds, err := t.tx.TxPipelined(t.ctx, func(pipe v8.Pipeliner) error {
+		p = &Pipeline{
+			pipe: pipe,
+			ctx:  t.ctx,
+		}
+		e := fn(p)
+		queued = e == nil
+		return e
+	})
+	if queued {
+		p.executed = true
+	}
+	return firstErr(cmds, err)
+}
+
+// watchMaxRetries Watch 事务冲突时的最大重试次数
+const watchMaxRetries = 10
+
+// Watch 乐观事务：监视 keys 后执行 fn，提交时被监视的key发生变化则重新执行 fn
+// 重试 watchMaxRetries 次仍冲突时返回 v8.TxFailedErr
+func (r *Redis) Watch(ctx context.Context, keys []string, fn func(tx *Tx) error) error {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+
+	var err error
+	for i := 0; i <= watchMaxRetries; i++ {
+		err = r.cli.Watch(ctxObj, func(tx *v8.Tx) error {
+			return fn(&Tx{
+				tx:  tx,
+				ctx: ctxObj,
+			})
+		}, keys...)
+		if err != v8.TxFailedErr {
+			return err
+		}
+
+		if ctxObj.Err() != nil {
+			return ctxObj.Err()
+		}
+	}
+	return err
+}
@@ -0,0 +1,300 @@
+// Package redis tool
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	v8 "github.com/go-redis/redis/v8"
+)
+
+// PubSubMessage 订阅收到的消息，通过模式订阅收到时 Pattern 不为空
+type PubSubMessage struct {
+	Channel string
+	Pattern string
+	Payload string
+}
+
+// MessageHandler 订阅消息处理函数
+type MessageHandler func(ctx context.Context, msg *PubSubMessage)
+
+// subscriptionBuffer 每个订阅缓冲的消息数，超过后新消息被丢弃
+const subscriptionBuffer = 1024
+
+// subscription 每个频道或模式一个分发协程，保证同一订阅内消息有序
+type subscription struct {
+	msgChan chan *PubSubMessage
+	handler MessageHandler
+}
+
+// Subscriber 订阅管理器，支持频道和模式订阅，每个订阅的消息在独立协程中按序处理
+// 连接断开后自动重连并重新订阅全部频道和模式；某个订阅处理过慢时只丢弃该订阅的消息，不影响其他订阅
+type Subscriber struct {
+	r *Redis
+
+	mu       sync.Mutex
+	ps       *v8.PubSub
+	channels map[string]*subscription
+	patterns map[string]*subscription
+	closed   bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewSubscriber 创建订阅管理器，使用完成后需要调用 Close
+func (r *Redis) NewSubscriber() *Subscriber {
+	s := new(Subscriber)
+	s.r = r
+	s.channels = make(map[string]*subscription)
+	s.patterns = make(map[string]*subscription)
+	s.ctx, s.cancel = context.WithCancel(r.ctx)
+	s.ps = r.cli.Subscribe(s.ctx)
+
+	s.wg.Add(1)
+	go s.receive()
+	return s
+}
+
+func (s *Subscriber) newSubscription(handler MessageHandler) *subscription {
+	sub := &subscription{
+		msgChan: make(chan *PubSubMessage, subscriptionBuffer),
+		handler: handler,
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for msg := range sub.msgChan {
+			s.dispatch(sub.handler, msg)
+		}
+	}()
+	return sub
+}
+
+// dispatch 执行 handler，panic 不影响其他消息
+func (s *Subscriber) dispatch(handler MessageHandler, msg *PubSubMessage) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Println(fmt.Errorf("pubsub channel %s handler panic: %v", msg.Channel, p))
+		}
+	}()
+
+	handler(s.ctx, msg)
+}
+
+// Subscribe 订阅频道，同一频道重复订阅时替换 handler
+func (s *Subscriber) Subscribe(ctx context.Context, handler MessageHandler, channels ...string) error {
+	return s.add(ctx, s.channels, handler, channels, func(ctx context.Context, ps *v8.PubSub, names ...string) error {
+		return ps.Subscribe(ctx, names...)
+	})
+}
+
+// PSubscribe 按模式订阅，同一模式重复订阅时替换 handler
+func (s *Subscriber) PSubscribe(ctx context.Context, handler MessageHandler, patterns ...string) error {
+	return s.add(ctx, s.patterns, handler, patterns, func(ctx context.Context, ps *v8.PubSub, names ...string) error {
+		return ps.PSubscribe(ctx, names...)
+	})
+}
+
+// Unsubscribe 取消频道订阅
+func (s *Subscriber) Unsubscribe(ctx context.Context, channels ...string) error {
+	return s.remove(ctx, s.channels, channels, func(ctx context.Context, ps *v8.PubSub, names ...string) error {
+		return ps.Unsubscribe(ctx, names...)
+	})
+}
+
+// PUnsubscribe 取消模式订阅
+func (s *Subscriber) PUnsubscribe(ctx context.Context, patterns ...string) error {
+	return s.remove(ctx, s.patterns, patterns, func(ctx context.Context, ps *v8.PubSub, names ...string) error {
+		return ps.PUnsubscribe(ctx, names...)
+	})
+}
+
+func (s *Subscriber) add(ctx context.Context, subs map[string]*subscription, handler MessageHandler, names []string,
+	fn func(ctx context.Context, ps *v8.PubSub, names ...string) error) error {
+	if handler == nil || len(names) <= 0 {
+		return fmt.Errorf("handler and channels must be set")
+	}
+	if ctx == nil {
+		ctx = s.ctx
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return fmt.Errorf("redis subscriber is closed")
+	}
+
+	err := fn(ctx, s.ps, names...)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if old, ok := subs[name]; ok {
+			close(old.msgChan)
+		}
+		subs[name] = s.newSubscription(handler)
+	}
+	return nil
+}
+
+func (s *Subscriber) remove(ctx context.Context, subs map[string]*subscription, names []string,
+	fn func(ctx context.Context, ps *v8.PubSub, names ...string) error) error {
+	if ctx == nil {
+		ctx = s.ctx
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+
+	err := fn(ctx, s.ps, names...)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if old, ok := subs[name]; ok {
+			close(old.msgChan)
+			delete(subs, name)
+		}
+	}
+	return nil
+}
+
+// receive 接收消息并分发到对应订阅，出错时重建连接并重新订阅
+func (s *Subscriber) receive() {
+	defer s.wg.Done()
+
+	for {
+		s.mu.Lock()
+		ps := s.ps
+		s.mu.Unlock()
+
+		msg, err := ps.ReceiveTimeout(s.ctx, 30*time.Second)
+		if s.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				err = ps.Ping(s.ctx)
+				if err == nil {
+					continue
+				}
+			}
+
+			log.Println(err)
+			time.Sleep(time.Second)
+			s.resubscribe()
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *v8.Message:
+			s.route(&PubSubMessage{
+				Channel: m.Channel,
+				Pattern: m.Pattern,
+				Payload: m.Payload,
+			})
+		case *v8.Subscription, *v8.Pong:
+		default:
+			log.Println(fmt.Errorf("redis pubsub unknown message: %T", m))
+		}
+	}
+}
+
+// route 分发到对应订阅；订阅的缓冲已满（handler 处理过慢）时丢弃消息并记录日志，
+// 不阻塞其他订阅的分发，也避免 handler 内调用 Subscribe/Unsubscribe 时死锁
+func (s *Subscriber) route(msg *PubSubMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sub *subscription
+	if msg.Pattern != "" {
+		sub = s.patterns[msg.Pattern]
+	} else {
+		sub = s.channels[msg.Channel]
+	}
+	if sub == nil {
+		return
+	}
+
+	select {
+	case sub.msgChan <- msg:
+	default:
+		log.Println(fmt.Errorf("pubsub channel %s handler is too slow, message dropped", msg.Channel))
+	}
+}
+
+// resubscribe 重建 PubSub 连接并重新订阅全部频道和模式
+func (s *Subscriber) resubscribe() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+
+	err := s.ps.Close()
+	if err != nil {
+		log.Println(err)
+	}
+	s.ps = s.r.cli.Subscribe(s.ctx)
+
+	channels := make([]string, 0, len(s.channels))
+	for name := range s.channels {
+		channels = append(channels, name)
+	}
+	if len(channels) > 0 {
+		err = s.ps.Subscribe(s.ctx, channels...)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	patterns := make([]string, 0, len(s.patterns))
+	for name := range s.patterns {
+		patterns = append(patterns, name)
+	}
+	if len(patterns) > 0 {
+		err = s.ps.PSubscribe(s.ctx, patterns...)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// Close 取消全部订阅并关闭连接，等待正在处理的消息完成
+func (s *Subscriber) Close() error {
+	s.cancel()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	err := s.ps.Close()
+	for name, sub := range s.channels {
+		close(sub.msgChan)
+		delete(s.channels, name)
+	}
+	for name, sub := range s.patterns {
+		close(sub.msgChan)
+		delete(s.patterns, name)
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
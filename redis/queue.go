@@ -0,0 +1,235 @@
+// Package redis tool
+package redis
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	v8 "github.com/go-redis/redis/v8"
+)
+
+// 可靠队列使用以下key：
+// name             待处理列表，LPUSH 入队，右端出队
+// name:processing  处理中列表，出队时通过 BLMOVE 原子移入
+// name:deadline    zset，处理中的列表元素 -> 可见性超时的毫秒时间
+// 列表元素格式为 "消息ID:消息体"，重新投递时生成新的消息ID，旧投递的 Ack/Nack 不会影响新投递
+
+// queueRequeueBatch 每次 Requeue 最多移动的消息数量，以及检查未登记超时时间的消息数量
+const queueRequeueBatch = 100
+
+// queueAckScript 从处理中列表删除消息并清除超时时间，返回删除数量
+var queueAckScript = v8.NewScript(`
+redis.call("ZREM", KEYS[3], ARGV[1])
+return redis.call("LREM", KEYS[2], 1, ARGV[1])
+`)
+
+// queueNackScript 消息从处理中列表移回待处理列表，下一个被消费，返回移动数量
+var queueNackScript = v8.NewScript(`
+redis.call("ZREM", KEYS[3], ARGV[1])
+local n = redis.call("LREM", KEYS[2], 1, ARGV[1])
+if n > 0 then
+	redis.call("RPUSH", KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// queueExtendScript 消息仍在处理中时更新可见性超时，返回1；已被确认或重新投递时返回0
+var queueExtendScript = v8.NewScript(`
+if redis.call("ZSCORE", KEYS[3], ARGV[1]) then
+	redis.call("ZADD", KEYS[3], ARGV[2], ARGV[1])
+	return 1
+end
+return 0
+`)
+
+// queueRequeueScript 超过可见性超时的消息以新的消息ID移回待处理列表，返回移动数量
+// 处理中列表最旧的 ARGV[3] 条消息中没有超时时间的（消费者在 BLMOVE 之后、登记超时之前崩溃）先登记一个超时周期
+// ARGV: 当前毫秒时间、可见性超时毫秒、批量大小、新消息ID前缀
+var queueRequeueScript = v8.NewScript(`
+local now = tonumber(ARGV[1])
+local batch = tonumber(ARGV[3])
+local tail = redis.call("LRANGE", KEYS[2], -batch, -1)
+for _, item in ipairs(tail) do
+	if not redis.call("ZSCORE", KEYS[3], item) then
+		redis.call("ZADD", KEYS[3], now + tonumber(ARGV[2]), item)
+	end
+end
+
+local items = redis.call("ZRANGEBYSCORE", KEYS[3], "-inf", now, "LIMIT", 0, batch)
+local count = 0
+for _, item in ipairs(items) do
+	redis.call("ZREM", KEYS[3], item)
+	local sep = string.find(item, ":", 1, true)
+	if sep and redis.call("LREM", KEYS[2], -1, item) > 0 then
+		count = count + 1
+		redis.call("RPUSH", KEYS[1], ARGV[4] .. count .. string.sub(item, sep))
+	end
+end
+return count
+`)
+
+// QueueItem 队列消息
+type QueueItem struct {
+	ID   string
+	Body string
+
+	raw string
+}
+
+// Queue 基于list的可靠队列，消费者取出的消息在确认前保存在处理中列表
+// 超过可见性超时未确认的消息由 Requeue 以新的消息ID移回待处理列表，需要 redis 6.2+（BLMOVE）
+type Queue struct {
+	r          *Redis
+	keys       []string
+	visibility time.Duration
+}
+
+// NewQueue 创建可靠队列，visibility 为消息取出后的可见性超时
+func (r *Redis) NewQueue(name string, visibility time.Duration) *Queue {
+	if visibility <= 0 {
+		panic("visibility must gt 0")
+	}
+
+	q := new(Queue)
+	q.r = r
+	q.keys = []string{name, r.hashTagKey(name, ":processing"), r.hashTagKey(name, ":deadline")}
+	q.visibility = visibility
+	return q
+}
+
+// Push 消息入队，返回待处理列表长度
+func (q *Queue) Push(ctx context.Context, body ...string) (int64, error) {
+	if len(body) <= 0 {
+		return 0, nil
+	}
+
+	values := make([]interface{}, len(body))
+	for i, b := range body {
+		values[i] = newLockVal() + ":" + b
+	}
+	return q.r.LPush(ctx, q.keys[0], values...)
+}
+
+// Pop 阻塞取出一条消息并移入处理中列表，超时返回nil
+// 取出的消息需要在可见性超时内调用 Ack，否则会被重新投递
+func (q *Queue) Pop(ctx context.Context, timeout time.Duration) (*QueueItem, error) {
+	raw, err := q.r.BLMove(ctx, q.keys[0], q.keys[1], "RIGHT", "LEFT", timeout)
+	if err != nil {
+		return nil, err
+	}
+	if raw == "" {
+		return nil, nil
+	}
+
+	id, body, ok := strings.Cut(raw, ":")
+	if !ok {
+		return nil, fmt.Errorf("redis queue item format error: %s", raw)
+	}
+	item := &QueueItem{
+		ID:   id,
+		Body: body,
+		raw:  raw,
+	}
+
+	_, err = q.r.ZAdd(ctx, q.keys[2], raw, float64(time.Now().Add(q.visibility).UnixMilli()))
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// Extend 延长消息的可见性超时，处理时间较长时调用，消息已被重新投递时返回 ErrLockNotOwned
+func (q *Queue) Extend(ctx context.Context, item *QueueItem, d time.Duration) error {
+	return q.run(ctx, queueExtendScript, item, time.Now().Add(d).UnixMilli())
+}
+
+// Ack 确认消息处理完成，消息已被重新投递时返回 ErrLockNotOwned
+func (q *Queue) Ack(ctx context.Context, item *QueueItem) error {
+	return q.run(ctx, queueAckScript, item)
+}
+
+// Nack 消息处理失败，立即移回待处理列表，消息已被重新投递时返回 ErrLockNotOwned
+func (q *Queue) Nack(ctx context.Context, item *QueueItem) error {
+	return q.run(ctx, queueNackScript, item)
+}
+
+func (q *Queue) run(ctx context.Context, script *v8.Script, item *QueueItem, args ...interface{}) error {
+	ctxObj := q.r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+
+	n, err := script.Run(ctxObj, q.r.cli, q.keys, append([]interface{}{item.raw}, args...)...).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockNotOwned
+	}
+	return nil
+}
+
+// Requeue 超过可见性超时的消息以新的消息ID移回待处理列表，返回移动数量，需要定期调用
+// 每次最多移动 queueRequeueBatch 条，返回值等于 queueRequeueBatch 时可能还有超时的消息
+func (q *Queue) Requeue(ctx context.Context) (int64, error) {
+	ctxObj := q.r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+
+	return queueRequeueScript.Run(ctxObj, q.r.cli, q.keys,
+		time.Now().UnixMilli(), q.visibility.Milliseconds(), queueRequeueBatch, newLockVal()+"-").Int64()
+}
+
+// Len 待处理消息数量
+func (q *Queue) Len(ctx context.Context) (int64, error) {
+	return q.r.LLen(ctx, q.keys[0])
+}
+
+// Consume 循环消费消息直到 ctx 结束，handler 返回nil时 Ack，否则 Nack
+// 每个可见性超时周期执行一次 Requeue
+func (q *Queue) Consume(ctx context.Context, handler func(ctx context.Context, item *QueueItem) error) error {
+	if ctx == nil {
+		ctx = q.r.ctx
+	}
+
+	lastRequeue := time.Time{}
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if time.Since(lastRequeue) >= q.visibility {
+			_, err := q.Requeue(ctx)
+			if err != nil {
+				log.Println(err)
+			}
+			lastRequeue = time.Now()
+		}
+
+		item, err := q.Pop(ctx, time.Second)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Println(err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if item == nil {
+			continue
+		}
+
+		if handler(ctx, item) == nil {
+			err = q.Ack(ctx, item)
+		} else {
+			err = q.Nack(ctx, item)
+		}
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Package redis tool
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v8 "github.com/go-redis/redis/v8"
+)
+
+// quotaScript 固定窗口配额：当前计数加 ARGV[2] 不超过 ARGV[1] 时累加，保留窗口剩余时间
+// key 不存在或没有过期时间时开启新窗口，窗口长度 ARGV[3] 毫秒
+// 返回 {是否放行(1/0), 剩余配额, 窗口剩余毫秒}
+var quotaScript = v8.NewScript(`
+local max = tonumber(ARGV[1])
+local add = tonumber(ARGV[2])
+local cur = tonumber(redis.call("GET", KEYS[1]) or "0") or 0
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl < 0 then
+	cur = 0
+	ttl = tonumber(ARGV[3])
+end
+if cur + add > max then
+	return {0, max - cur, ttl}
+end
+if cur == 0 then
+	redis.call("SET", KEYS[1], add, "PX", ttl)
+else
+	redis.call("INCRBY", KEYS[1], add)
+end
+return {1, max - cur - add, ttl}
+`)
+
+// QuotaPolicy redis出错时配额的处理策略
+type QuotaPolicy int
+
+const (
+	// QuotaFailClosed 出错时视为被限制
+	QuotaFailClosed QuotaPolicy = iota
+	// QuotaFailOpen 出错时放行
+	QuotaFailOpen
+)
+
+// QuotaResult 配额检查结果
+type QuotaResult struct {
+	// Limited 是否被限制
+	Limited bool
+	// Remaining 剩余配额
+	Remaining int64
+	// ResetAfter 窗口剩余时间，之后配额重置
+	ResetAfter time.Duration
+}
+
+// QuotaTake 固定窗口资源量限制，在一个Lua脚本中原子完成检查和累加
+// 出错时按 policy 设置 Limited，并返回对应error
+func (r *Redis) QuotaTake(ctx context.Context, limitKey string, maxCount, addCount int64, exp time.Duration, policy QuotaPolicy) (QuotaResult, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+
+	failRet := QuotaResult{
+		Limited: policy != QuotaFailOpen,
+	}
+	if addCount > maxCount {
+		return QuotaResult{Limited: true}, nil
+	}
+
+	ret, err := quotaScript.Run(ctxObj, r.cli, []string{limitKey}, maxCount, addCount, exp.Milliseconds()).Int64Slice()
+	if err != nil {
+		return failRet, err
+	}
+	if len(ret) != 3 {
+		return failRet, fmt.Errorf("redis quota script result error: %v", ret)
+	}
+
+	return QuotaResult{
+		Limited:    ret[0] == 0,
+		Remaining:  ret[1],
+		ResetAfter: time.Duration(ret[2]) * time.Millisecond,
+	}, nil
+}
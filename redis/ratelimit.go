@@ -0,0 +1,390 @@
+// Package redis tool
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	v8 "github.com/go-redis/redis/v8"
+)
+
+// slidingLogScript 滑动日志限流：zset 记录窗口内每次请求的时间戳
+// ARGV: 当前毫秒时间、窗口毫秒、窗口内最大请求数、本次请求数、成员前缀
+// 返回 {是否放行(1/0), 剩余次数, 重试等待毫秒}
+var slidingLogScript = v8.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+if count + n > limit then
+	local retry = window
+	local oldest = redis.call("ZRANGE", KEYS[1], count + n - limit - 1, count + n - limit - 1, "WITHSCORES")
+	if #oldest > 0 then
+		retry = tonumber(oldest[2]) + window - now
+	end
+	return {0, limit - count, retry}
+end
+for i = 1, n do
+	redis.call("ZADD", KEYS[1], now, ARGV[5] .. ":" .. i)
+end
+redis.call("PEXPIRE", KEYS[1], window)
+return {1, limit - count - n, 0}
+`)
+
+// slidingWindowScript 滑动窗口计数限流：按上一个窗口计数加权估算当前窗口内的请求数
+// KEYS: 当前窗口计数、上一个窗口计数
+// ARGV: 当前毫秒时间、窗口毫秒、窗口内最大请求数、本次请求数
+// 返回 {是否放行(1/0), 剩余次数, 重试等待毫秒}
+var slidingWindowScript = v8.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local elapsed = now % window
+local cur = tonumber(redis.call("GET", KEYS[1]) or "0") or 0
+local prev = tonumber(redis.call("GET", KEYS[2]) or "0") or 0
+local est = math.floor(prev * (window - elapsed) / window) + cur
+if est + n > limit then
+	local retry = window - elapsed
+	if cur + n <= limit and prev > 0 then
+		local weight = (limit - cur - n) / prev
+		retry = math.ceil(window * (1 - weight)) - elapsed
+	end
+	if retry < 1 then
+		retry = 1
+	end
+	return {0, limit - est, retry}
+end
+redis.call("INCRBY", KEYS[1], n)
+redis.call("PEXPIRE", KEYS[1], window * 2)
+return {1, limit - est - n, 0}
+`)
+
+// RateLimitResult 限流检查结果
+type RateLimitResult struct {
+	// Allowed 是否放行
+	Allowed bool
+	// Remaining 剩余可用次数
+	Remaining int64
+	// RetryAfter 被限制时建议的重试等待时间，小于0表示本次请求数超过上限，永远无法放行
+	RetryAfter time.Duration
+}
+
+func parseRateLimitResult(ret []int64, err error) (RateLimitResult, error) {
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	if len(ret) != 3 {
+		return RateLimitResult{}, fmt.Errorf("redis rate limit script result error: %v", ret)
+	}
+
+	remaining := ret[1]
+	if remaining < 0 {
+		remaining = 0
+	}
+	return RateLimitResult{
+		Allowed:    ret[0] == 1,
+		Remaining:  remaining,
+		RetryAfter: time.Duration(ret[2]) * time.Millisecond,
+	}, nil
+}
+
+// SlidingLogLimiter 滑动日志限流器，精确统计任意 window 时间内的请求数
+// 每次请求占用 zset 的一个成员，适合 limit 较小的场景
+type SlidingLogLimiter struct {
+	r      *Redis
+	key    string
+	limit  int64
+	window time.Duration
+}
+
+// NewSlidingLogLimiter 创建滑动日志限流器，任意 window 时间内最多 limit 次请求，window 精度为毫秒
+func (r *Redis) NewSlidingLogLimiter(key string, limit int64, window time.Duration) *SlidingLogLimiter {
+	if limit <= 0 || window < time.Millisecond {
+		panic("limit must gt 0 and window must ge 1ms")
+	}
+
+	l := new(SlidingLogLimiter)
+	l.r = r
+	l.key = key
+	l.limit = limit
+	l.window = window
+	return l
+}
+
+// Allow 请求一次
+func (l *SlidingLogLimiter) Allow(ctx context.Context) (RateLimitResult, error) {
+	return l.AllowN(ctx, 1)
+}
+
+// AllowN 请求 n 次，n 必须大于0
+func (l *SlidingLogLimiter) AllowN(ctx context.Context, n int64) (RateLimitResult, error) {
+	ctxObj := l.r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+
+	if n <= 0 {
+		return RateLimitResult{}, fmt.Errorf("redis rate limit n must gt 0: %d", n)
+	}
+	if n > l.limit {
+		return RateLimitResult{RetryAfter: -1}, nil
+	}
+
+	return parseRateLimitResult(slidingLogScript.Run(ctxObj, l.r.cli, []string{l.key},
+		time.Now().UnixMilli(), l.window.Milliseconds(), l.limit, n, newLockVal()).Int64Slice())
+}
+
+// SlidingWindowLimiter 滑动窗口计数限流器，用上一个固定窗口的计数加权估算，消除窗口边界的突发
+// 只占用两个计数key，适合 limit 较大的场景
+type SlidingWindowLimiter struct {
+	r      *Redis
+	key    string
+	limit  int64
+	window time.Duration
+}
+
+// NewSlidingWindowLimiter 创建滑动窗口计数限流器，window 时间内最多约 limit 次请求，window 精度为毫秒
+func (r *Redis) NewSlidingWindowLimiter(key string, limit int64, window time.Duration) *SlidingWindowLimiter {
+	if limit <= 0 || window < time.Millisecond {
+		panic("limit must gt 0 and window must ge 1ms")
+	}
+
+	l := new(SlidingWindowLimiter)
+	l.r = r
+	l.key = key
+	l.limit = limit
+	l.window = window
+	return l
+}
+
+// Allow 请求一次
+func (l *SlidingWindowLimiter) Allow(ctx context.Context) (RateLimitResult, error) {
+	return l.AllowN(ctx, 1)
+}
+
+// AllowN 请求 n 次，n 必须大于0
+func (l *SlidingWindowLimiter) AllowN(ctx context.Context, n int64) (RateLimitResult, error) {
+	ctxObj := l.r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+
+	if n <= 0 {
+		return RateLimitResult{}, fmt.Errorf("redis rate limit n must gt 0: %d", n)
+	}
+	if n > l.limit {
+		return RateLimitResult{RetryAfter: -1}, nil
+	}
+
+	now := time.Now().UnixMilli()
+	window := l.window.Milliseconds()
+	idx := now / window
+	keys := []string{
+		l.r.hashTagKey(l.key, fmt.Sprintf(":%d", idx)),
+		l.r.hashTagKey(l.key, fmt.Sprintf(":%d", idx-1)),
+	}
+	return parseRateLimitResult(slidingWindowScript.Run(ctxObj, l.r.cli, keys, now, window, l.limit, n).Int64Slice())
+}
+
+// tokenBucketScript 令牌桶限流：hash 保存当前令牌数和上次补充时间
+// ARGV: 每秒生成令牌数、桶容量、当前毫秒时间、本次请求令牌数
+// 返回 {是否放行(1/0), 剩余令牌数, 重试等待毫秒}
+var tokenBucketScript = v8.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local data = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed = 0
+local retry = 0
+if tokens >= n then
+	tokens = tokens - n
+	allowed = 1
+else
+	retry = math.ceil((n - tokens) * 1000 / rate)
+end
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return {allowed, math.floor(tokens), retry}
+`)
+
+// gcraScript GCRA（通用信元速率算法）限流：key 保存理论到达时间（TAT）
+// ARGV: 发放间隔毫秒（1000/rate）、突发容量、当前毫秒时间、本次请求数
+// 返回 {是否放行(1/0), 剩余次数, 重试等待毫秒}
+var gcraScript = v8.NewScript(`
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local tat = tonumber(redis.call("GET", KEYS[1]) or "0") or 0
+if tat < now then
+	tat = now
+end
+local newTat = tat + interval * n
+local allowAt = newTat - interval * burst
+if now < allowAt then
+	return {0, math.floor((now - (tat - interval * burst)) / interval), math.ceil(allowAt - now)}
+end
+redis.call("SET", KEYS[1], tostring(newTat), "PX", math.ceil(newTat - now))
+return {1, math.floor((now - allowAt) / interval), 0}
+`)
+
+// ErrRateLimitExceeded 本次请求数超过限流器的容量，永远无法放行
+var ErrRateLimitExceeded = errors.New("redis rate limit request exceeds limiter capacity")
+
+// waitN 循环请求 n 次直到放行，被限制时按 RetryAfter 等待，ctx 结束时返回 ctx.Err()
+func waitN(ctx context.Context, allowN func(ctx context.Context, n int64) (RateLimitResult, error), n int64) error {
+	for {
+		ret, err := allowN(ctx, n)
+		if err != nil {
+			return err
+		}
+		if ret.Allowed {
+			return nil
+		}
+		if ret.RetryAfter < 0 {
+			return ErrRateLimitExceeded
+		}
+
+		wait := ret.RetryAfter
+		if wait < time.Millisecond {
+			wait = time.Millisecond
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// TokenBucketLimiter 令牌桶限流器，每秒生成 rate 个令牌，最多累积 burst 个
+type TokenBucketLimiter struct {
+	r     *Redis
+	key   string
+	rate  float64
+	burst int64
+}
+
+// NewTokenBucketLimiter 创建令牌桶限流器
+func (r *Redis) NewTokenBucketLimiter(key string, rate float64, burst int64) *TokenBucketLimiter {
+	if rate <= 0 || burst <= 0 {
+		panic("rate and burst must gt 0")
+	}
+
+	l := new(TokenBucketLimiter)
+	l.r = r
+	l.key = key
+	l.rate = rate
+	l.burst = burst
+	return l
+}
+
+// Allow 获取一个令牌
+func (l *TokenBucketLimiter) Allow(ctx context.Context) (RateLimitResult, error) {
+	return l.AllowN(ctx, 1)
+}
+
+// AllowN 获取 n 个令牌，n 必须大于0
+func (l *TokenBucketLimiter) AllowN(ctx context.Context, n int64) (RateLimitResult, error) {
+	ctxObj := l.r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+
+	if n <= 0 {
+		return RateLimitResult{}, fmt.Errorf("redis rate limit n must gt 0: %d", n)
+	}
+	if n > l.burst {
+		return RateLimitResult{RetryAfter: -1}, nil
+	}
+
+	return parseRateLimitResult(tokenBucketScript.Run(ctxObj, l.r.cli, []string{l.key},
+		l.rate, l.burst, time.Now().UnixMilli(), n).Int64Slice())
+}
+
+// Wait 阻塞直到获取一个令牌或 ctx 结束
+func (l *TokenBucketLimiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN 阻塞直到获取 n 个令牌或 ctx 结束，n 超过 burst 时返回 ErrRateLimitExceeded
+func (l *TokenBucketLimiter) WaitN(ctx context.Context, n int64) error {
+	if ctx == nil {
+		ctx = l.r.ctx
+	}
+	return waitN(ctx, l.AllowN, n)
+}
+
+// GCRALimiter GCRA 限流器，平均每秒 rate 次，最多允许 burst 次突发
+// 只保存一个时间戳，比令牌桶更省空间，放行更平滑
+type GCRALimiter struct {
+	r        *Redis
+	key      string
+	interval float64
+	burst    int64
+}
+
+// NewGCRALimiter 创建 GCRA 限流器
+func (r *Redis) NewGCRALimiter(key string, rate float64, burst int64) *GCRALimiter {
+	if rate <= 0 || burst <= 0 {
+		panic("rate and burst must gt 0")
+	}
+
+	l := new(GCRALimiter)
+	l.r = r
+	l.key = key
+	l.interval = 1000 / rate
+	l.burst = burst
+	return l
+}
+
+// Allow 请求一次
+func (l *GCRALimiter) Allow(ctx context.Context) (RateLimitResult, error) {
+	return l.AllowN(ctx, 1)
+}
+
+// AllowN 请求 n 次，n 必须大于0
+func (l *GCRALimiter) AllowN(ctx context.Context, n int64) (RateLimitResult, error) {
+	ctxObj := l.r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+
+	if n <= 0 {
+		return RateLimitResult{}, fmt.Errorf("redis rate limit n must gt 0: %d", n)
+	}
+	if n > l.burst {
+		return RateLimitResult{RetryAfter: -1}, nil
+	}
+
+	return parseRateLimitResult(gcraScript.Run(ctxObj, l.r.cli, []string{l.key},
+		l.interval, l.burst, time.Now().UnixMilli(), n).Int64Slice())
+}
+
+// Wait 阻塞直到放行一次或 ctx 结束
+func (l *GCRALimiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN 阻塞直到放行 n 次或 ctx 结束，n 超过 burst 时返回 ErrRateLimitExceeded
+func (l *GCRALimiter) WaitN(ctx context.Context, n int64) error {
+	if ctx == nil {
+		ctx = l.r.ctx
+	}
+	return waitN(ctx, l.AllowN, n)
+}
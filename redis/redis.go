@@ -3,28 +3,36 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	v8 "github.com/go-redis/redis/v8"
+
+	"github.com/assembly-hub/basics/util"
 )
 
 type Redis struct {
 	opt *Options
-	cli *v8.Client
+	cli v8.UniversalClient
 	ctx context.Context
+	// cluster 集群模式，关联key需要hash tag
+	cluster bool
 }
 
 func NewRedis(opt *Options) *Redis {
 	return NewRedisWithCtx(context.Background(), opt)
 }
 
+// NewRedisWithCtx 按 opt.Mode 创建单机、哨兵或集群客户端
 func NewRedisWithCtx(ctx context.Context, opt *Options) *Redis {
-	redisConn := v8.NewClient(&opt.Options)
+	redisConn := opt.newClient()
 	r := new(Redis)
 	r.cli = redisConn
 	r.opt = opt
 	r.ctx = ctx
+	r.cluster = opt.Mode == ModeCluster
 	return r
 }
 
@@ -32,13 +40,39 @@ func FromV8(cli *v8.Client) *Redis {
 	r := new(Redis)
 	r.cli = cli
 	r.opt = &Options{
-		*cli.Options(),
+		Options: *cli.Options(),
+	}
+	r.ctx = context.Background()
+	return r
+}
+
+// FromUniversal 包装已有的 v8 客户端，支持 *v8.Client（单机、哨兵）和 *v8.ClusterClient
+func FromUniversal(cli v8.UniversalClient) *Redis {
+	if c, ok := cli.(*v8.Client); ok {
+		return FromV8(c)
+	}
+
+	r := new(Redis)
+	r.cli = cli
+	r.opt = new(Options)
+	if c, ok := cli.(*v8.ClusterClient); ok {
+		r.opt.Mode = ModeCluster
+		r.opt.Addrs = c.Options().Addrs
+		r.cluster = true
 	}
 	r.ctx = context.Background()
 	return r
 }
 
+// RawRedis 原始客户端，单机和哨兵模式为 *v8.Client
+// 集群模式的客户端为 *v8.ClusterClient，此方法返回nil，集群模式需要使用 RawUniversal
 func (r *Redis) RawRedis() *v8.Client {
+	cli, _ := r.cli.(*v8.Client)
+	return cli
+}
+
+// RawUniversal 原始客户端，单机和哨兵模式为 *v8.Client，集群模式为 *v8.ClusterClient，适用于所有部署模式
+func (r *Redis) RawUniversal() v8.UniversalClient {
 	return r.cli
 }
 
@@ -46,8 +80,49 @@ func (r *Redis) RawCtx() context.Context {
 	return r.ctx
 }
 
+// Raw 原始客户端和 ctx，客户端同 RawRedis，集群模式为nil，集群模式需要使用 RawUniversal 和 RawCtx
 func (r *Redis) Raw() (*v8.Client, context.Context) {
-	return r.cli, r.ctx
+	return r.RawRedis(), r.ctx
+}
+
+// ForEachMaster 在每个主节点上执行 fn，集群模式下用于 Scan 等只作用于单个节点的命令，其他模式直接执行 fn
+func (r *Redis) ForEachMaster(ctx context.Context, fn func(ctx context.Context, node *Redis) error) error {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+
+	cluster, ok := r.cli.(*v8.ClusterClient)
+	if !ok {
+		return fn(ctxObj, r)
+	}
+	return cluster.ForEachMaster(ctxObj, func(ctx context.Context, cli *v8.Client) error {
+		node := new(Redis)
+		node.cli = cli
+		node.opt = r.opt
+		node.ctx = r.ctx
+		node.cluster = r.cluster
+		return fn(ctx, node)
+	})
+}
+
+// hashTagKey 返回与 key 位于同一个slot的关联key，用于在同一个脚本中与 key 一起访问
+// 集群模式下 key 没有hash tag时以 "{key}" 为前缀，与 key 本身的slot相同；其他模式直接拼接
+// key 中包含 "}" 但没有有效的hash tag时无法构造相同slot的key，直接拼接，集群模式下需要在 key 中自带hash tag
+func (r *Redis) hashTagKey(key, suffix string) string {
+	if !r.cluster || hasHashTag(key) || strings.IndexByte(key, '}') >= 0 {
+		return key + suffix
+	}
+	return "{" + key + "}" + suffix
+}
+
+// hasHashTag key 中是否包含非空的hash tag
+func hasHashTag(key string) bool {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return false
+	}
+	return strings.IndexByte(key[start+1:], '}') > 0
 }
 
 func (r *Redis) Close() error {
@@ -228,6 +303,10 @@ func (r *Redis) Exists(ctx context.Context, key ...string) (int64, error) {
 	return ret, nil
 }
 
+// ErrNotFound key 不存在，也用于 Cache 的 loader 返回数据不存在
+var ErrNotFound = errors.New("redis key not found")
+
+// Get key 不存在时返回空字符串，需要区分不存在和空值时使用 Lookup
 func (r *Redis) Get(ctx context.Context, key string) (string, error) {
 	ctxObj := r.ctx
 	if ctx != nil {
@@ -250,6 +329,20 @@ func (r *Redis) Get(ctx context.Context, key string) (string, error) {
 	return ret, nil
 }
 
+// Lookup 与 Get 相同，key 不存在时返回 ErrNotFound
+func (r *Redis) Lookup(ctx context.Context, key string) (string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+
+	ret, err := r.cli.Get(ctxObj, key).Result()
+	if err == v8.Nil {
+		return "", ErrNotFound
+	}
+	return ret, err
+}
+
 func (r *Redis) SetRange(ctx context.Context, key string, offset int64, value string) (int64, error) {
 	ctxObj := r.ctx
 	if ctx != nil {
@@ -481,6 +574,7 @@ func (r *Redis) BitField(ctx context.Context, key string, args ...interface{}) (
 	return ret, nil
 }
 
+// Scan 集群模式下只扫描一个节点，遍历全部key使用 ForEachMaster
 func (r *Redis) Scan(ctx context.Context, cursor uint64, match string, count int64) (keys []string, cur uint64, err error) {
 	ctxObj := r.ctx
 	if ctx != nil {
@@ -500,6 +594,7 @@ func (r *Redis) Scan(ctx context.Context, cursor uint64, match string, count int
 	return result, cur, nil
 }
 
+// ScanType 集群模式下只扫描一个节点，遍历全部key使用 ForEachMaster
 func (r *Redis) ScanType(ctx context.Context, cursor uint64, match string, count int64, keyType string) (keys []string, cur uint64, err error) {
 	ctxObj := r.ctx
 	if ctx != nil {
@@ -952,6 +1047,42 @@ func (r *Redis) SUnionStore(ctx context.Context, destination string, keys ...str
 	return ret, nil
 }
 
+// ZMember 有序集合成员
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// ZKeyMember 阻塞弹出的有序集合成员及其所在的key
+type ZKeyMember struct {
+	ZMember
+	Key string
+}
+
+func toZMembers(zList []v8.Z) []ZMember {
+	ret := make([]ZMember, len(zList))
+	for i, z := range zList {
+		ret[i] = ZMember{
+			Member: fmt.Sprint(z.Member),
+			Score:  z.Score,
+		}
+	}
+	return ret
+}
+
+func toZKeyMember(z *v8.ZWithKey) *ZKeyMember {
+	if z == nil {
+		return nil
+	}
+	return &ZKeyMember{
+		ZMember: ZMember{
+			Member: fmt.Sprint(z.Member),
+			Score:  z.Score,
+		},
+		Key: z.Key,
+	}
+}
+
 // zset funcs
 func (r *Redis) ZAdd(ctx context.Context, key string, member interface{}, score float64) (int64, error) {
 	ctxObj := r.ctx
@@ -975,8 +1106,8 @@ func (r *Redis) ZAdd(ctx context.Context, key string, member interface{}, score
 	return ret, nil
 }
 
-// ZAddList memList: {member: m1, score: 1}
-func (r *Redis) ZAddList(ctx context.Context, key string, memList ...map[string]interface{}) (int64, error) {
+// ZAddList 批量添加成员
+func (r *Redis) ZAddList(ctx context.Context, key string, memList ...ZMember) (int64, error) {
 	count := len(memList)
 	if count <= 0 {
 		return 0, nil
@@ -989,8 +1120,8 @@ func (r *Redis) ZAddList(ctx context.Context, key string, memList ...map[string]
 	zList := make([]*v8.Z, count)
 	for i, mem := range memList {
 		zList[i] = &v8.Z{
-			Member: mem["member"],
-			Score:  mem["score"].(float64),
+			Member: mem.Member,
+			Score:  mem.Score,
 		}
 	}
 	cmd := r.cli.ZAdd(ctxObj, key, zList...)
@@ -1065,3 +1196,1165 @@ func (r *Redis) ZRangeByScore(ctx context.Context, key, min, max string, offset,
 
 	return ret, nil
 }
+
+// ZScore 成员不存在时 exists 为false
+func (r *Redis) ZScore(ctx context.Context, key, member string) (float64, bool, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.ZScore(ctxObj, key, member)
+	if cmd == nil {
+		return 0, false, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		if err == v8.Nil {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	return ret, true, nil
+}
+
+func (r *Redis) ZIncrBy(ctx context.Context, key string, increment float64, member string) (float64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.ZIncrBy(ctxObj, key, increment, member)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+// ZRank 按分数从小到大的排名，成员不存在时 exists 为false
+func (r *Redis) ZRank(ctx context.Context, key, member string) (int64, bool, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.ZRank(ctxObj, key, member)
+	if cmd == nil {
+		return 0, false, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		if err == v8.Nil {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	return ret, true, nil
+}
+
+// ZRevRank 按分数从大到小的排名，成员不存在时 exists 为false
+func (r *Redis) ZRevRank(ctx context.Context, key, member string) (int64, bool, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.ZRevRank(ctxObj, key, member)
+	if cmd == nil {
+		return 0, false, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		if err == v8.Nil {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	return ret, true, nil
+}
+
+func (r *Redis) ZCard(ctx context.Context, key string) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.ZCard(ctxObj, key)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) ZCount(ctx context.Context, key, min, max string) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.ZCount(ctxObj, key, min, max)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) ZRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.ZRange(ctxObj, key, start, stop)
+	if cmd == nil {
+		return nil, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) ZRangeWithScores(ctx context.Context, key string, start, stop int64) ([]ZMember, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.ZRangeWithScores(ctxObj, key, start, stop)
+	if cmd == nil {
+		return nil, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return toZMembers(ret), nil
+}
+
+func (r *Redis) ZRevRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.ZRevRange(ctxObj, key, start, stop)
+	if cmd == nil {
+		return nil, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) ([]ZMember, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.ZRevRangeWithScores(ctxObj, key, start, stop)
+	if cmd == nil {
+		return nil, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return toZMembers(ret), nil
+}
+
+func (r *Redis) ZRangeByScoreWithScores(ctx context.Context, key, min, max string, offset, count int64) ([]ZMember, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	opt := v8.ZRangeBy{
+		Min:    min,
+		Max:    max,
+		Offset: offset,
+		Count:  count,
+	}
+	cmd := r.cli.ZRangeByScoreWithScores(ctxObj, key, &opt)
+	if cmd == nil {
+		return nil, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return toZMembers(ret), nil
+}
+
+func (r *Redis) ZRevRangeByScore(ctx context.Context, key, max, min string, offset, count int64) ([]string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	opt := v8.ZRangeBy{
+		Min:    min,
+		Max:    max,
+		Offset: offset,
+		Count:  count,
+	}
+	cmd := r.cli.ZRevRangeByScore(ctxObj, key, &opt)
+	if cmd == nil {
+		return nil, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) ZPopMin(ctx context.Context, key string, count int64) ([]ZMember, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.ZPopMin(ctxObj, key, count)
+	if cmd == nil {
+		return nil, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return toZMembers(ret), nil
+}
+
+func (r *Redis) ZPopMax(ctx context.Context, key string, count int64) ([]ZMember, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.ZPopMax(ctxObj, key, count)
+	if cmd == nil {
+		return nil, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return toZMembers(ret), nil
+}
+
+// BZPopMin 阻塞弹出分数最小的成员，超时返回nil
+func (r *Redis) BZPopMin(ctx context.Context, timeout time.Duration, keys ...string) (*ZKeyMember, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.BZPopMin(ctxObj, timeout, keys...)
+	if cmd == nil {
+		return nil, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		if err == v8.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return toZKeyMember(ret), nil
+}
+
+// BZPopMax 阻塞弹出分数最大的成员，超时返回nil
+func (r *Redis) BZPopMax(ctx context.Context, timeout time.Duration, keys ...string) (*ZKeyMember, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.BZPopMax(ctxObj, timeout, keys...)
+	if cmd == nil {
+		return nil, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		if err == v8.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return toZKeyMember(ret), nil
+}
+
+// ZUnionStore weights 为空时权重均为1，aggregate 取值 SUM、MIN、MAX，为空时为 SUM
+func (r *Redis) ZUnionStore(ctx context.Context, destination string, keys []string, weights []float64, aggregate string) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	store := v8.ZStore{
+		Keys:      keys,
+		Weights:   weights,
+		Aggregate: aggregate,
+	}
+	cmd := r.cli.ZUnionStore(ctxObj, destination, &store)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+// ZInterStore weights 为空时权重均为1，aggregate 取值 SUM、MIN、MAX，为空时为 SUM
+func (r *Redis) ZInterStore(ctx context.Context, destination string, keys []string, weights []float64, aggregate string) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	store := v8.ZStore{
+		Keys:      keys,
+		Weights:   weights,
+		Aggregate: aggregate,
+	}
+	cmd := r.cli.ZInterStore(ctxObj, destination, &store)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+// hash funcs
+func (r *Redis) HSet(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.HSet(ctxObj, key, values...)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) HSetNX(ctx context.Context, key, field string, value interface{}) (bool, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.HSetNX(ctxObj, key, field, value)
+	if cmd == nil {
+		return false, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return false, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) HGet(ctx context.Context, key, field string) (string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.HGet(ctxObj, key, field)
+	if cmd == nil {
+		return "", fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		if err == v8.Nil {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return ret, nil
+}
+
+// HMGet 不存在的field对应位置为nil
+func (r *Redis) HMGet(ctx context.Context, key string, fields ...string) ([]interface{}, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.HMGet(ctxObj, key, fields...)
+	if cmd == nil {
+		return nil, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.HGetAll(ctxObj, key)
+	if cmd == nil {
+		return nil, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) HDel(ctx context.Context, key string, fields ...string) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.HDel(ctxObj, key, fields...)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) HIncrBy(ctx context.Context, key, field string, incr int64) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.HIncrBy(ctxObj, key, field, incr)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) HIncrByFloat(ctx context.Context, key, field string, incr float64) (float64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.HIncrByFloat(ctxObj, key, field, incr)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) HExists(ctx context.Context, key, field string) (bool, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.HExists(ctxObj, key, field)
+	if cmd == nil {
+		return false, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return false, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) HKeys(ctx context.Context, key string) ([]string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.HKeys(ctxObj, key)
+	if cmd == nil {
+		return nil, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) HVals(ctx context.Context, key string) ([]string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.HVals(ctxObj, key)
+	if cmd == nil {
+		return nil, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) HLen(ctx context.Context, key string) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.HLen(ctxObj, key)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+// list funcs
+func (r *Redis) LPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.LPush(ctxObj, key, values...)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) LPushX(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.LPushX(ctxObj, key, values...)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) RPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.RPush(ctxObj, key, values...)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) RPushX(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.RPushX(ctxObj, key, values...)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) LInsertBefore(ctx context.Context, key string, pivot, value interface{}) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.LInsertBefore(ctxObj, key, pivot, value)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) LInsertAfter(ctx context.Context, key string, pivot, value interface{}) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.LInsertAfter(ctxObj, key, pivot, value)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) LLen(ctx context.Context, key string) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.LLen(ctxObj, key)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) LRem(ctx context.Context, key string, count int64, value interface{}) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.LRem(ctxObj, key, count, value)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+// LPop 列表为空时返回空字符串
+func (r *Redis) LPop(ctx context.Context, key string) (string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.LPop(ctxObj, key)
+	if cmd == nil {
+		return "", fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		if err == v8.Nil {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return ret, nil
+}
+
+// RPop 列表为空时返回空字符串
+func (r *Redis) RPop(ctx context.Context, key string) (string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.RPop(ctxObj, key)
+	if cmd == nil {
+		return "", fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		if err == v8.Nil {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) LPopCount(ctx context.Context, key string, count int) ([]string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.LPopCount(ctxObj, key, count)
+	if cmd == nil {
+		return nil, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		if err == v8.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) RPopCount(ctx context.Context, key string, count int) ([]string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.RPopCount(ctxObj, key, count)
+	if cmd == nil {
+		return nil, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		if err == v8.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) LIndex(ctx context.Context, key string, index int64) (string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.LIndex(ctxObj, key, index)
+	if cmd == nil {
+		return "", fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		if err == v8.Nil {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.LRange(ctxObj, key, start, stop)
+	if cmd == nil {
+		return nil, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) LSet(ctx context.Context, key string, index int64, value interface{}) error {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.LSet(ctxObj, key, index, value)
+	if cmd == nil {
+		return fmt.Errorf("redis client error")
+	}
+
+	_, err := cmd.Result()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *Redis) LTrim(ctx context.Context, key string, start, stop int64) error {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.LTrim(ctxObj, key, start, stop)
+	if cmd == nil {
+		return fmt.Errorf("redis client error")
+	}
+
+	_, err := cmd.Result()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *Redis) RPopLPush(ctx context.Context, source, destination string) (string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.RPopLPush(ctxObj, source, destination)
+	if cmd == nil {
+		return "", fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		if err == v8.Nil {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return ret, nil
+}
+
+// LMove srcPos destPos 取值 LEFT 或 RIGHT，源列表为空时返回空字符串
+func (r *Redis) LMove(ctx context.Context, source, destination, srcPos, destPos string) (string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.LMove(ctxObj, source, destination, srcPos, destPos)
+	if cmd == nil {
+		return "", fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		if err == v8.Nil {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return ret, nil
+}
+
+// BLPop 返回 [key, value]，超时返回nil
+func (r *Redis) BLPop(ctx context.Context, timeout time.Duration, keys ...string) ([]string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.BLPop(ctxObj, timeout, keys...)
+	if cmd == nil {
+		return nil, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		if err == v8.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// BRPop 返回 [key, value]，超时返回nil
+func (r *Redis) BRPop(ctx context.Context, timeout time.Duration, keys ...string) ([]string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.BRPop(ctxObj, timeout, keys...)
+	if cmd == nil {
+		return nil, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		if err == v8.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// BRPopLPush 超时返回空字符串
+func (r *Redis) BRPopLPush(ctx context.Context, source, destination string, timeout time.Duration) (string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.BRPopLPush(ctxObj, source, destination, timeout)
+	if cmd == nil {
+		return "", fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		if err == v8.Nil {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return ret, nil
+}
+
+// BLMove srcPos destPos 取值 LEFT 或 RIGHT，超时返回空字符串
+func (r *Redis) BLMove(ctx context.Context, source, destination, srcPos, destPos string, timeout time.Duration) (string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.BLMove(ctxObj, source, destination, srcPos, destPos, timeout)
+	if cmd == nil {
+		return "", fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		if err == v8.Nil {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return ret, nil
+}
+
+// stream funcs
+
+// XAdd 添加消息，返回消息ID；maxLen 大于0时近似裁剪（MAXLEN ~）stream长度
+func (r *Redis) XAdd(ctx context.Context, stream string, maxLen int64, values map[string]interface{}) (string, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	args := v8.XAddArgs{
+		Stream: stream,
+		ID:     "*",
+		Values: values,
+	}
+	if maxLen > 0 {
+		args.MaxLen = maxLen
+		args.Approx = true
+	}
+	cmd := r.cli.XAdd(ctxObj, &args)
+	if cmd == nil {
+		return "", fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return "", err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) XAck(ctx context.Context, stream, group string, ids ...string) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.XAck(ctxObj, stream, group, ids...)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) XDel(ctx context.Context, stream string, ids ...string) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.XDel(ctxObj, stream, ids...)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+func (r *Redis) XLen(ctx context.Context, stream string) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.XLen(ctxObj, stream)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+// XGroupCreate 创建消费组，stream 不存在时自动创建，消费组已存在时不报错
+func (r *Redis) XGroupCreate(ctx context.Context, stream, group, start string) error {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.XGroupCreateMkStream(ctxObj, stream, group, start)
+	if cmd == nil {
+		return fmt.Errorf("redis client error")
+	}
+
+	_, err := cmd.Result()
+	if err != nil {
+		if util.StartWith(err.Error(), "BUSYGROUP", false) {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// pubsub funcs
+
+// Publish 发布消息，返回收到消息的订阅者数量
+func (r *Redis) Publish(ctx context.Context, channel string, message interface{}) (int64, error) {
+	ctxObj := r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+	cmd := r.cli.Publish(ctxObj, channel, message)
+	if cmd == nil {
+		return 0, fmt.Errorf("redis client error")
+	}
+
+	ret, err := cmd.Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+// PublishJSON 消息序列化为json后发布
+func (r *Redis) PublishJSON(ctx context.Context, channel string, message interface{}) (int64, error) {
+	s, err := util.Any2JSON(message)
+	if err != nil {
+		return 0, err
+	}
+	return r.Publish(ctx, channel, s)
+}
@@ -130,12 +130,12 @@ func SimpleGetLock() {
 
 	lockKey := "test111"
 
-	err := r.GetLock(lockKey, nil, 100)
+	token, err := r.GetLock(lockKey, nil, 100)
 	if err != nil {
 		panic(err)
 	}
 	defer func() {
-		e := r.FreeLock(lockKey)
+		e := r.FreeLock(lockKey, token)
 		if e != nil {
 			log.Println(e)
 		}
@@ -187,7 +187,7 @@ func SimpleStreamAdd() {
 	r := NewRedis(&opts)
 	defer r.Close()
 
-	cli, ctx := r.Raw()
+	cli, ctx := r.RawUniversal(), r.RawCtx()
 
 	streamKey := "test_stream"
 
@@ -242,7 +242,7 @@ func SimpleReadStreamsAndAck() {
 	r := NewRedis(&opts)
 	defer r.Close()
 
-	cli, ctx := r.Raw()
+	cli, ctx := r.RawUniversal(), r.RawCtx()
 
 	streamKey := "test_stream"
 	groupName := "test_group"
@@ -321,7 +321,7 @@ func SimpleReadStreamsAndAck2() {
 	r := NewRedis(&opts)
 	defer r.Close()
 
-	cli, ctx := r.Raw()
+	cli, ctx := r.RawUniversal(), r.RawCtx()
 
 	streamKey := "test_stream"
 	groupName := "test_group"
@@ -462,3 +462,299 @@ func SimpleWithLock() {
 		fmt.Println("ok")
 	})
 }
+
+func SimpleAcquireLock() {
+	opts := DefaultOptions()
+	opts.Addr = "127.0.0.1:6379"
+	opts.DB = 0
+
+	r := NewRedis(&opts)
+	defer r.Close()
+
+	l, err := r.AcquireLock("test_key", nil, 3, 3, 500)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		e := l.Release()
+		if e != nil {
+			log.Println(e)
+		}
+	}()
+
+	select {
+	case <-l.Context().Done():
+		fmt.Println("lock lost")
+	case <-time.After(10 * time.Second):
+		fmt.Println("ok")
+	}
+}
+
+func SimpleWithLockCtx() {
+	opts := DefaultOptions()
+	opts.Addr = "127.0.0.1:6379"
+	opts.DB = 0
+
+	r := NewRedis(&opts)
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	lockOpts := DefaultLockOptions()
+	lockOpts.Expiration = 10 * time.Second
+	err := r.WithLockCtx(ctx, "test_key", &lockOpts, func(ctx context.Context) error {
+		fmt.Println("ok")
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func SimpleLeaderElector() {
+	opts := DefaultOptions()
+	opts.Addr = "127.0.0.1:6379"
+	opts.DB = 0
+
+	r := NewRedis(&opts)
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	e := r.NewLeaderElector("test_leader", "node-1", 5*time.Second, LeaderCallbacks{
+		OnStartedLeading: func(ctx context.Context) {
+			fence, _ := FenceFromContext(ctx)
+			fmt.Println("started leading, term: ", fence)
+			<-ctx.Done()
+		},
+		OnStoppedLeading: func() {
+			fmt.Println("stopped leading")
+		},
+		OnNewLeader: func(identity string) {
+			fmt.Println("leader: ", identity)
+		},
+	})
+
+	err := e.Run(ctx)
+	fmt.Println(err)
+}
+
+func SimpleStreamConsumer() {
+	opts := DefaultOptions()
+	opts.Addr = "127.0.0.1:6379"
+	opts.DB = 0
+
+	r := NewRedis(&opts)
+	defer r.Close()
+
+	streamKey := "test_stream"
+	_, err := r.XAdd(context.Background(), streamKey, 10000, map[string]interface{}{
+		"key1": "value1",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	consumerOpts := DefaultStreamConsumerOptions()
+	consumerOpts.Stream = streamKey
+	consumerOpts.Group = "test_group"
+	consumerOpts.Consumer = "test_consumer"
+	consumerOpts.Concurrency = 3
+
+	c := r.NewStreamConsumer(consumerOpts, func(ctx context.Context, msg *StreamMessage) error {
+		fmt.Println(msg.ID, msg.Values)
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+	fmt.Println(c.Run(ctx))
+}
+
+func SimpleSubscriber() {
+	opts := DefaultOptions()
+	opts.Addr = "127.0.0.1:6379"
+	opts.DB = 0
+
+	r := NewRedis(&opts)
+	defer r.Close()
+
+	s := r.NewSubscriber()
+	defer s.Close()
+
+	err := s.Subscribe(context.Background(), func(ctx context.Context, msg *PubSubMessage) {
+		fmt.Println(msg.Channel, msg.Payload)
+	}, "test_channel")
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = r.Publish(context.Background(), "test_channel", "hello")
+	if err != nil {
+		panic(err)
+	}
+
+	time.Sleep(time.Second)
+}
+
+func SimplePipeline() {
+	opts := DefaultOptions()
+	opts.Addr = "127.0.0.1:6379"
+	opts.DB = 0
+
+	r := NewRedis(&opts)
+	defer r.Close()
+
+	p := r.Pipeline()
+	setRet := p.Set("test_key", "1")
+	incrRet := p.Incr("test_key")
+	getRet := p.Get("test_key")
+	err := p.Exec(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(setRet.Val(), incrRet.Val(), getRet.Val())
+
+	err = r.Watch(context.Background(), []string{"test_key"}, func(tx *Tx) error {
+		val, err := tx.Get("test_key")
+		if err != nil {
+			return err
+		}
+
+		return tx.Exec(func(p *Pipeline) error {
+			p.Set("test_key", val+"0")
+			return nil
+		})
+	})
+	fmt.Println(err)
+}
+
+func SimpleCluster() {
+	opts := DefaultOptions()
+	opts.Mode = ModeCluster
+	opts.Addrs = []string{"127.0.0.1:7000", "127.0.0.1:7001", "127.0.0.1:7002"}
+
+	r := NewRedis(&opts)
+	defer r.Close()
+
+	err := r.ForEachMaster(context.Background(), func(ctx context.Context, node *Redis) error {
+		keys, _, err := node.Scan(ctx, 0, "test_*", 100)
+		fmt.Println(keys)
+		return err
+	})
+	fmt.Println(err)
+}
+
+func SimpleSentinel() {
+	opts := DefaultOptions()
+	opts.Mode = ModeSentinel
+	opts.MasterName = "mymaster"
+	opts.Addrs = []string{"127.0.0.1:26379", "127.0.0.1:26380", "127.0.0.1:26381"}
+
+	r := NewRedis(&opts)
+	defer r.Close()
+
+	fmt.Println(r.Ping(context.Background()))
+}
+
+func SimpleCache() {
+	opts := DefaultOptions()
+	opts.Addr = "127.0.0.1:6379"
+	opts.DB = 0
+
+	r := NewRedis(&opts)
+	defer r.Close()
+
+	type user struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	c := NewCache[*user](r, &CacheOptions{
+		Prefix:  "user:",
+		LockTTL: 3 * time.Second,
+	})
+
+	u, err := c.GetOrLoad(context.Background(), "1", time.Minute, func(ctx context.Context) (*user, error) {
+		return &user{ID: 1, Name: "test"}, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(u.ID, u.Name)
+}
+
+func SimpleCacheRefresh() {
+	opts := DefaultOptions()
+	opts.Addr = "127.0.0.1:6379"
+	opts.DB = 0
+
+	r := NewRedis(&opts)
+	defer r.Close()
+
+	c := NewCache[string](r, &CacheOptions{
+		Prefix:  "config:",
+		LockTTL: 3 * time.Second,
+	})
+
+	val, err := c.GetOrRefresh(context.Background(), "test", RefreshOptions{
+		Soft: time.Minute,
+		Hard: 10 * time.Minute,
+		Beta: 1,
+	}, func(ctx context.Context) (string, error) {
+		return "value", nil
+	})
+	fmt.Println(val, err)
+}
+
+func SimpleTwoLevelCache() {
+	opts := DefaultOptions()
+	opts.Addr = "127.0.0.1:6379"
+	opts.DB = 0
+
+	r := NewRedis(&opts)
+	defer r.Close()
+
+	localOpts := DefaultLocalCacheOptions()
+	localOpts.TTL = 10 * time.Second
+
+	c, err := NewTwoLevelCache[string](r, &CacheOptions{Prefix: "config:"}, &localOpts)
+	if err != nil {
+		panic(err)
+	}
+	defer c.Close()
+
+	val, err := c.GetOrLoad(context.Background(), "test", time.Minute, func(ctx context.Context) (string, error) {
+		return "value", nil
+	})
+	fmt.Println(val, err)
+
+	// 其他实例的 L1 同时失效
+	err = c.Set(context.Background(), "test", "new_value", time.Minute)
+	fmt.Println(err)
+}
+
+func SimpleNegativeCache() {
+	opts := DefaultOptions()
+	opts.Addr = "127.0.0.1:6379"
+	opts.DB = 0
+
+	r := NewRedis(&opts)
+	defer r.Close()
+
+	_, err := r.Lookup(context.Background(), "test_missing_key")
+	fmt.Println(err == ErrNotFound)
+
+	c := NewCache[string](r, &CacheOptions{
+		Prefix:      "user:",
+		NegativeTTL: 10 * time.Second,
+	})
+
+	// 10秒内再次读取直接返回 ErrNotFound，不调用 loader
+	_, err = c.GetOrLoad(context.Background(), "0", time.Minute, func(ctx context.Context) (string, error) {
+		return "", ErrNotFound
+	})
+	fmt.Println(err == ErrNotFound)
+}
@@ -0,0 +1,54 @@
+// Package redis tool
+package redis
+
+import (
+	"testing"
+)
+
+func TestHasHashTag(t *testing.T) {
+	cases := []struct {
+		key  string
+		want bool
+	}{
+		{"user", false},
+		{"{user}", true},
+		{"{user}:1", true},
+		{"pre{user}post", true},
+		{"{}", false},
+		{"{}{user}", false},
+		{"{user", false},
+		{"user}", false},
+	}
+
+	for _, c := range cases {
+		if got := hasHashTag(c.key); got != c.want {
+			t.Errorf("hasHashTag(%q) got %v, want %v", c.key, got, c.want)
+		}
+	}
+}
+
+func TestHashTagKey(t *testing.T) {
+	single := &Redis{}
+	cluster := &Redis{cluster: true}
+
+	cases := []struct {
+		r      *Redis
+		key    string
+		suffix string
+		want   string
+	}{
+		{single, "lock", ":fence", "lock:fence"},
+		{single, "{lock}", ":fence", "{lock}:fence"},
+		{cluster, "lock", ":fence", "{lock}:fence"},
+		{cluster, "{lock}", ":fence", "{lock}:fence"},
+		{cluster, "app:{lock}:1", ":fence", "app:{lock}:1:fence"},
+		{cluster, "{}lock", ":fence", "{}lock:fence"},
+		{cluster, "lock}", ":fence", "lock}:fence"},
+	}
+
+	for _, c := range cases {
+		if got := c.r.hashTagKey(c.key, c.suffix); got != c.want {
+			t.Errorf("hashTagKey(%q, %q) cluster=%v got %q, want %q", c.key, c.suffix, c.r.cluster, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+// Package redis tool
+package redis
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	v8 "github.com/go-redis/redis/v8"
+)
+
+// semAcquireScript 清理过期许可，剩余许可足够时一次性获取全部，返回1，否则返回0
+// zset 成员为许可ID，score 为许可过期毫秒时间，按redis服务端时间计算
+// ARGV: 许可总数、许可有效期毫秒、许可ID...
+var semAcquireScript = v8.NewScript(scriptNow + `
+local limit = tonumber(ARGV[1])
+local ttl = tonumber(ARGV[2])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now)
+if redis.call("ZCARD", KEYS[1]) + #ARGV - 2 > limit then
+	return 0
+end
+for i = 3, #ARGV do
+	redis.call("ZADD", KEYS[1], now + ttl, ARGV[i])
+end
+if redis.call("PTTL", KEYS[1]) < ttl then
+	redis.call("PEXPIRE", KEYS[1], ttl)
+end
+return 1
+`)
+
+// semRefreshScript 续期仍未过期的许可，返回续期成功的数量
+// ARGV: 许可有效期毫秒、许可ID...
+var semRefreshScript = v8.NewScript(scriptNow + `
+local ttl = tonumber(ARGV[1])
+local count = 0
+for i = 2, #ARGV do
+	local score = redis.call("ZSCORE", KEYS[1], ARGV[i])
+	if score and tonumber(score) > now then
+		redis.call("ZADD", KEYS[1], now + ttl, ARGV[i])
+		count = count + 1
+	end
+end
+if redis.call("PTTL", KEYS[1]) < ttl then
+	redis.call("PEXPIRE", KEYS[1], ttl)
+end
+return count
+`)
+
+// semCountScript 未过期的许可数量
+var semCountScript = v8.NewScript(scriptNow + `
+return redis.call("ZCOUNT", KEYS[1], "(" .. now, "+inf")
+`)
+
+// Semaphore 分布式信号量，限制跨实例的并发数
+// 每个许可单独过期（LockOptions.Expiration），持有者崩溃后许可自动回收
+// 不支持 LockOptions.Fencing
+type Semaphore struct {
+	r     *Redis
+	key   string
+	limit int64
+	opts  LockOptions
+}
+
+// Permit 已获取的许可
+type Permit struct {
+	s   *Semaphore
+	ids []string
+}
+
+// NewSemaphore 创建分布式信号量，最多同时发放 limit 个许可
+// 获取许可的重试、退避和超时沿用 LockOptions，Value 不使用
+func (r *Redis) NewSemaphore(key string, limit int64, opts *LockOptions) *Semaphore {
+	if limit <= 0 {
+		panic("limit must gt 0")
+	}
+
+	s := new(Semaphore)
+	s.r = r
+	s.key = key
+	s.limit = limit
+	s.opts = opts.normalize()
+	return s
+}
+
+// Key 信号量的key
+func (s *Semaphore) Key() string {
+	return s.key
+}
+
+// Acquire 获取 n 个许可，许可不足时按 LockOptions 的退避策略重试，直到成功、重试次数用完或 ctx 结束
+// 失败返回 ErrLockNotObtained
+func (s *Semaphore) Acquire(ctx context.Context, n int64) (*Permit, error) {
+	if ctx == nil {
+		ctx = s.r.ctx
+	}
+	if n <= 0 || n > s.limit {
+		return nil, fmt.Errorf("%w: permits %d out of range (0, %d]", ErrLockNotObtained, n, s.limit)
+	}
+
+	prefix := newLockVal()
+	ids := make([]string, n)
+	args := make([]interface{}, 0, n+2)
+	args = append(args, s.limit, s.opts.Expiration.Milliseconds())
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%s:%d", prefix, i)
+		args = append(args, ids[i])
+	}
+
+	err := s.opts.retry(ctx, func(ctx context.Context) (bool, error) {
+		ret, err := semAcquireScript.Run(ctx, s.r.cli, []string{s.key}, args...).Int64()
+		if err != nil {
+			return false, err
+		}
+		return ret == 1, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p := new(Permit)
+	p.s = s
+	p.ids = ids
+	return p, nil
+}
+
+// Available 当前可用的许可数
+func (s *Semaphore) Available(ctx context.Context) (int64, error) {
+	ctxObj := s.r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+
+	count, err := semCountScript.Run(ctxObj, s.r.cli, []string{s.key}).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return s.limit - count, nil
+}
+
+// WithPermits 获取 n 个许可后执行 fn，执行完成后释放，返回 fn 的错误
+// fn 执行期间每 Expiration/3 续期一次，许可丢失（或续期出错且下一次续期之前许可可能过期）时取消 fn 的 ctx
+func (s *Semaphore) WithPermits(ctx context.Context, n int64, fn func(ctx context.Context) error) error {
+	if ctx == nil {
+		ctx = s.r.ctx
+	}
+
+	p, err := s.Acquire(ctx, n)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		e := p.Release(context.Background())
+		if e != nil {
+			log.Println(e)
+		}
+	}()
+
+	fnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go p.watchdog(time.Now(), stop, done, cancel)
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	return fn(fnCtx)
+}
+
+// Count 许可数量
+func (p *Permit) Count() int {
+	return len(p.ids)
+}
+
+// Refresh 续期全部许可，执行时间可能超过 Expiration 时需要定期调用
+// 部分许可已过期被回收时返回 ErrLockNotOwned
+func (p *Permit) Refresh(ctx context.Context) error {
+	ctxObj := p.s.r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+
+	args := make([]interface{}, 0, len(p.ids)+1)
+	args = append(args, p.s.opts.Expiration.Milliseconds())
+	for _, id := range p.ids {
+		args = append(args, id)
+	}
+
+	ret, err := semRefreshScript.Run(ctxObj, p.s.r.cli, []string{p.s.key}, args...).Int64()
+	if err != nil {
+		return err
+	}
+	if ret < int64(len(p.ids)) {
+		return ErrLockNotOwned
+	}
+	return nil
+}
+
+// watchdog 每 Expiration/3 续期一次，与 Lock.watchdog 相同，保证 cancel 在许可过期之前调用
+func (p *Permit) watchdog(lastRenew time.Time, stop <-chan struct{}, done chan<- struct{}, cancel context.CancelFunc) {
+	defer close(done)
+
+	exp := p.s.opts.Expiration
+	interval := exp / 3
+	if interval <= 0 {
+		interval = exp
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		start := time.Now()
+		ctx, opCancel := context.WithTimeout(context.Background(), p.s.opts.OpTimeout)
+		err := p.Refresh(ctx)
+		opCancel()
+		if err == ErrLockNotOwned {
+			log.Println(err)
+			cancel()
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			if time.Since(lastRenew)+interval >= exp {
+				cancel()
+				return
+			}
+			continue
+		}
+		lastRenew = start
+	}
+}
+
+// Release 归还全部许可
+func (p *Permit) Release(ctx context.Context) error {
+	ctxObj := p.s.r.ctx
+	if ctx != nil {
+		ctxObj = ctx
+	}
+
+	members := make([]interface{}, len(p.ids))
+	for i, id := range p.ids {
+		members[i] = id
+	}
+	_, err := p.s.r.ZRem(ctxObj, p.s.key, members...)
+	return err
+}
@@ -0,0 +1,415 @@
+// Package redis tool
+package redis
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	v8 "github.com/go-redis/redis/v8"
+)
+
+// StreamMessage stream消息
+type StreamMessage struct {
+	Stream string
+	ID     string
+	Values map[string]interface{}
+	// Deliveries 投递次数，首次投递为1
+	Deliveries int64
+}
+
+// StreamHandler 消息处理函数，返回nil时消息被ACK，否则保留在待确认列表中，超时后重新投递
+type StreamHandler func(ctx context.Context, msg *StreamMessage) error
+
+// StreamConsumerOptions 消费组参数
+type StreamConsumerOptions struct {
+	Stream   string
+	Group    string
+	Consumer string
+	// StartID 创建消费组时的起始ID，"0" 从头消费，"$" 只消费新消息
+	StartID string
+	// Concurrency 并发处理的协程数
+	Concurrency int
+	// BatchSize 每次 XREADGROUP 读取的消息数
+	BatchSize int64
+	// Block XREADGROUP 阻塞等待时间
+	Block time.Duration
+	// ClaimMinIdle 待确认超过该时间的消息通过 XPENDING + XCLAIM 认领并重新处理，0 表示不认领
+	ClaimMinIdle time.Duration
+	// ClaimInterval 一轮认领结束后，开始下一轮认领的间隔
+	ClaimInterval time.Duration
+	// DeadLetter 死信策略
+	DeadLetter DeadLetterOptions
+}
+
+// DeadLetterOptions 死信策略，消息投递次数超过 MaxDeliveries 后不再交给 handler
+type DeadLetterOptions struct {
+	// MaxDeliveries 最大投递次数，0 表示不限制
+	MaxDeliveries int64
+	// Stream 死信stream，为空时为 原stream+":dead"
+	Stream string
+	// MaxLen 死信stream近似最大长度，0 表示不裁剪
+	MaxLen int64
+	// Drop 为true时直接ACK丢弃，不写入死信stream
+	Drop bool
+}
+
+var defaultStreamConsumerOpts = StreamConsumerOptions{
+	StartID:       "0",
+	Concurrency:   1,
+	BatchSize:     10,
+	Block:         2 * time.Second,
+	ClaimMinIdle:  time.Minute,
+	ClaimInterval: 30 * time.Second,
+}
+
+func DefaultStreamConsumerOptions() StreamConsumerOptions {
+	return defaultStreamConsumerOpts
+}
+
+// StreamConsumer stream消费组运行器
+type StreamConsumer struct {
+	r       *Redis
+	opts    StreamConsumerOptions
+	handler StreamHandler
+}
+
+// NewStreamConsumer 创建消费组运行器，Stream、Group、Consumer 必须设置，其他参数为零值时使用默认值
+func (r *Redis) NewStreamConsumer(opts StreamConsumerOptions, handler StreamHandler) *StreamConsumer {
+	if opts.Stream == "" || opts.Group == "" || opts.Consumer == "" || handler == nil {
+		panic("stream, group, consumer and handler must be set")
+	}
+
+	if opts.StartID == "" {
+		opts.StartID = defaultStreamConsumerOpts.StartID
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultStreamConsumerOpts.Concurrency
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultStreamConsumerOpts.BatchSize
+	}
+	if opts.Block <= 0 {
+		opts.Block = defaultStreamConsumerOpts.Block
+	}
+	if opts.ClaimInterval <= 0 {
+		opts.ClaimInterval = defaultStreamConsumerOpts.ClaimInterval
+	}
+	if opts.DeadLetter.Stream == "" {
+		opts.DeadLetter.Stream = opts.Stream + ":dead"
+	}
+
+	c := new(StreamConsumer)
+	c.r = r
+	c.opts = opts
+	c.handler = handler
+	return c
+}
+
+// Run 创建消费组（已存在时忽略），读取消息并以 Concurrency 个协程并发处理，直到 ctx 结束
+// 处理成功的消息被ACK，待确认超过 ClaimMinIdle 的消息被当前消费者认领并重新处理
+// 设置了 DeadLetter.MaxDeliveries 时，投递次数超限的消息转入死信stream
+func (c *StreamConsumer) Run(ctx context.Context) error {
+	if ctx == nil {
+		ctx = c.r.ctx
+	}
+
+	err := c.r.XGroupCreate(ctx, c.opts.Stream, c.opts.Group, c.opts.StartID)
+	if err != nil {
+		return err
+	}
+
+	msgChan := make(chan *StreamMessage, c.opts.Concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < c.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range msgChan {
+				c.handle(ctx, msg)
+			}
+		}()
+	}
+
+	c.fetch(ctx, msgChan)
+	close(msgChan)
+	wg.Wait()
+	return ctx.Err()
+}
+
+// fetch 循环读取新消息和认领超时消息，投递到 msgChan，直到 ctx 结束
+func (c *StreamConsumer) fetch(ctx context.Context, msgChan chan<- *StreamMessage) {
+	claimStart := "0-0"
+	lastClaim := time.Time{}
+	for ctx.Err() == nil {
+		var msgList []*StreamMessage
+
+		if c.opts.ClaimMinIdle > 0 && time.Since(lastClaim) >= c.opts.ClaimInterval {
+			claimedList, next, err := c.claim(ctx, claimStart)
+			if err != nil {
+				log.Println(err)
+			}
+			msgList = append(msgList, claimedList...)
+
+			// 游标为空表示一轮认领结束，等待下一个间隔
+			if err != nil || next == "" {
+				claimStart = "0-0"
+				lastClaim = time.Now()
+			} else {
+				claimStart = next
+			}
+		}
+
+		if len(msgList) <= 0 {
+			streams, err := c.r.cli.XReadGroup(ctx, &v8.XReadGroupArgs{
+				Group:    c.opts.Group,
+				Consumer: c.opts.Consumer,
+				Streams:  []string{c.opts.Stream, ">"},
+				Count:    c.opts.BatchSize,
+				Block:    c.opts.Block,
+			}).Result()
+			if err != nil && err != v8.Nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Println(err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			for _, s := range streams {
+				for _, m := range s.Messages {
+					msgList = append(msgList, &StreamMessage{
+						Stream:     c.opts.Stream,
+						ID:         m.ID,
+						Values:     m.Values,
+						Deliveries: 1,
+					})
+				}
+			}
+		}
+
+		for _, msg := range msgList {
+			select {
+			case <-ctx.Done():
+				return
+			case msgChan <- msg:
+			}
+		}
+	}
+}
+
+// claim 从 start 开始扫描一批待确认消息，通过 XCLAIM 认领空闲超过 ClaimMinIdle 的消息
+// 返回认领的消息和下一批的起始ID，扫描到末尾时下一批起始ID为空
+// 不使用 XAUTOCLAIM：go-redis v8.11.4 无法解析 redis 7 的 XAUTOCLAIM 返回（多了已删除ID列表），
+// XPENDING + XCLAIM 在 redis 5.0 及以上版本均可用
+func (c *StreamConsumer) claim(ctx context.Context, start string) ([]*StreamMessage, string, error) {
+	pending, err := c.r.cli.XPendingExt(ctx, &v8.XPendingExtArgs{
+		Stream: c.opts.Stream,
+		Group:  c.opts.Group,
+		Start:  start,
+		End:    "+",
+		Count:  c.opts.BatchSize,
+	}).Result()
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if int64(len(pending)) >= c.opts.BatchSize {
+		next = nextStreamID(pending[len(pending)-1].ID)
+	}
+
+	// XCLAIM 会增加投递次数，认领后的投递次数为当前次数+1
+	retry := make(map[string]int64, len(pending))
+	ids := make([]string, 0, len(pending))
+	for _, p := range pending {
+		if p.Idle >= c.opts.ClaimMinIdle {
+			retry[p.ID] = p.RetryCount
+			ids = append(ids, p.ID)
+		}
+	}
+	if len(ids) <= 0 {
+		return nil, next, nil
+	}
+
+	claimedList, err := c.r.cli.XClaim(ctx, &v8.XClaimArgs{
+		Stream:   c.opts.Stream,
+		Group:    c.opts.Group,
+		Consumer: c.opts.Consumer,
+		MinIdle:  c.opts.ClaimMinIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return nil, "", err
+	}
+
+	msgList := make([]*StreamMessage, 0, len(claimedList))
+	returned := make(map[string]bool, len(claimedList))
+	for _, m := range claimedList {
+		returned[m.ID] = true
+		// redis 7 以下，已从stream删除的消息以空内容返回
+		if m.Values == nil {
+			c.dropDeleted(ctx, m.ID)
+			continue
+		}
+		msgList = append(msgList, &StreamMessage{
+			Stream:     c.opts.Stream,
+			ID:         m.ID,
+			Values:     m.Values,
+			Deliveries: retry[m.ID] + 1,
+		})
+	}
+
+	// 未返回的消息已被其他消费者认领，或已从stream删除（redis 7 不返回已删除的消息）
+	for _, id := range ids {
+		if returned[id] {
+			continue
+		}
+		exists, err := c.r.cli.XRange(ctx, c.opts.Stream, id, id).Result()
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if len(exists) <= 0 {
+			c.dropDeleted(ctx, id)
+		}
+	}
+	return msgList, next, nil
+}
+
+// dropDeleted 已从stream删除（裁剪或XDEL）的消息：从待确认列表中移除，并清理失败原因
+func (c *StreamConsumer) dropDeleted(ctx context.Context, id string) {
+	_, err := c.r.XAck(ctx, c.opts.Stream, c.opts.Group, id)
+	if err != nil {
+		log.Println(err)
+	}
+	_, err = c.r.HDel(ctx, c.errorKey(), id)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// nextStreamID 紧随 id 之后的ID，用作 XPENDING 的起始ID（redis 6.2 以下不支持 "(" 排除起点）
+func nextStreamID(id string) string {
+	ms, seq, ok := strings.Cut(id, "-")
+	if !ok {
+		return id
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return id
+	}
+	if n == math.MaxUint64 {
+		m, err := strconv.ParseUint(ms, 10, 64)
+		if err != nil {
+			return id
+		}
+		return strconv.FormatUint(m+1, 10) + "-0"
+	}
+	return ms + "-" + strconv.FormatUint(n+1, 10)
+}
+
+// streamErrorTTL 失败原因hash的过期时间，每次记录失败时刷新
+// 字段在消息确认、转入死信或从stream删除后清理，过期时间兜底清理其他情况残留的字段
+const streamErrorTTL = 24 * time.Hour
+
+// errorKey 记录消息最近一次处理失败原因的hash
+func (c *StreamConsumer) errorKey() string {
+	return c.opts.Stream + ":" + c.opts.Group + ":errors"
+}
+
+func (c *StreamConsumer) handle(ctx context.Context, msg *StreamMessage) {
+	dl := c.opts.DeadLetter
+	if dl.MaxDeliveries > 0 && msg.Deliveries > dl.MaxDeliveries {
+		dlCtx, cancel := context.WithTimeout(context.Background(), time.Duration(3)*time.Second)
+		defer cancel()
+
+		reason, err := c.r.HGet(dlCtx, c.errorKey(), msg.ID)
+		if err != nil {
+			log.Println(err)
+		}
+		err = c.DeadLetter(dlCtx, msg, reason)
+		if err != nil {
+			log.Println(err)
+		}
+		return
+	}
+
+	err := c.safeHandle(ctx, msg)
+
+	// handler 可能执行较久，ACK 等操作的超时从 handler 返回后开始计算
+	opCtx, cancel := context.WithTimeout(context.Background(), time.Duration(3)*time.Second)
+	defer cancel()
+
+	if err != nil {
+		log.Println(err)
+		if dl.MaxDeliveries > 0 {
+			_, e := c.r.HSet(opCtx, c.errorKey(), msg.ID, err.Error())
+			if e == nil {
+				e = c.r.cli.Expire(opCtx, c.errorKey(), streamErrorTTL).Err()
+			}
+			if e != nil {
+				log.Println(e)
+			}
+		}
+		return
+	}
+
+	_, err = c.r.XAck(opCtx, c.opts.Stream, c.opts.Group, msg.ID)
+	if err != nil {
+		log.Println(err)
+	}
+	if dl.MaxDeliveries > 0 && msg.Deliveries > 1 {
+		_, err = c.r.HDel(opCtx, c.errorKey(), msg.ID)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// DeadLetter 将消息连同失败信息写入死信stream并ACK原消息，DeadLetterOptions.Drop 为true时只ACK
+// 死信消息保留原字段，并附加 dead_stream、dead_id、dead_group、dead_consumer、dead_deliveries、dead_reason、dead_time
+func (c *StreamConsumer) DeadLetter(ctx context.Context, msg *StreamMessage, reason string) error {
+	dl := c.opts.DeadLetter
+	if !dl.Drop {
+		values := make(map[string]interface{}, len(msg.Values)+7)
+		for k, v := range msg.Values {
+			values[k] = v
+		}
+		values["dead_stream"] = msg.Stream
+		values["dead_id"] = msg.ID
+		values["dead_group"] = c.opts.Group
+		values["dead_consumer"] = c.opts.Consumer
+		values["dead_deliveries"] = msg.Deliveries
+		values["dead_reason"] = reason
+		values["dead_time"] = time.Now().UnixMilli()
+
+		_, err := c.r.XAdd(ctx, dl.Stream, dl.MaxLen, values)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := c.r.XAck(ctx, c.opts.Stream, c.opts.Group, msg.ID)
+	if err != nil {
+		return err
+	}
+	_, err = c.r.HDel(ctx, c.errorKey(), msg.ID)
+	return err
+}
+
+// safeHandle 执行 handler，panic 视为处理失败
+func (c *StreamConsumer) safeHandle(ctx context.Context, msg *StreamMessage) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("stream %s message %s handler panic: %v", msg.Stream, msg.ID, p)
+		}
+	}()
+
+	return c.handler(ctx, msg)
+}
@@ -0,0 +1,20 @@
+// Package redis tool
+package redis
+
+import (
+	"testing"
+)
+
+func TestNextStreamID(t *testing.T) {
+	cases := map[string]string{
+		"0-0":                                "0-1",
+		"1526919030474-55":                   "1526919030474-56",
+		"1526919030474-18446744073709551615": "1526919030475-0",
+		"invalid":                            "invalid",
+	}
+	for id, want := range cases {
+		if got := nextStreamID(id); got != want {
+			t.Errorf("nextStreamID(%s) = %s, want %s", id, got, want)
+		}
+	}
+}